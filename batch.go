@@ -0,0 +1,171 @@
+package bamgoo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+type (
+	// Invocation is a single call in a batch.
+	Invocation struct {
+		Name    string
+		Value   Map
+		Setting Map
+	}
+
+	// Invoked is the outcome of an Invocation.
+	Invoked struct {
+		Name string
+		Data Map
+		Res  Res
+	}
+
+	// Batch controls a batch invocation.
+	// Concurrency caps calls in flight, 0 runs all at once.
+	// Timeout is the shared deadline of the whole batch.
+	// FailFast cancels the remaining calls after the first failure.
+	Batch struct {
+		Concurrency int
+		Timeout     time.Duration
+		FailFast    bool
+	}
+)
+
+// child returns a meta sharing identity with m but owning its own result,
+// so concurrent invocations do not race on the result slot.
+func (m *Meta) child() *Meta {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return &Meta{
+		ctx:      m.ctx,
+		traceId:  m.traceId,
+		spanId:   m.spanId,
+		parentId: m.parentId,
+		language: m.language,
+		timezone: m.timezone,
+		token:    m.token,
+		payload:  m.payload,
+		id:       m.id,
+	}
+}
+
+// adopt takes over temp files created by a child meta.
+func (m *Meta) adopt(child *Meta) {
+	child.mutex.Lock()
+	files := child.tempfiles
+	child.tempfiles = nil
+	child.mutex.Unlock()
+
+	if len(files) == 0 {
+		return
+	}
+	m.mutex.Lock()
+	m.tempfiles = append(m.tempfiles, files...)
+	m.mutex.Unlock()
+}
+
+// InvokeBatch runs invocations concurrently, results keep the input order.
+// The first failed Res is stored in meta.
+func (m *Meta) InvokeBatch(invocations []Invocation, batches ...Batch) []Invoked {
+	batch := Batch{}
+	if len(batches) > 0 {
+		batch = batches[0]
+	}
+	concurrency := batch.Concurrency
+	if concurrency <= 0 || concurrency > len(invocations) {
+		concurrency = len(invocations)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if batch.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(m.Context(), batch.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(m.Context())
+	}
+	defer cancel()
+
+	results := make([]Invoked, len(invocations))
+	slots := make(chan struct{}, max(concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, item := range invocations {
+		results[i].Name = item.Name
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Res = contextResult(ctx.Err())
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			<-slots
+			results[i].Res = contextResult(err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item Invocation) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			meta := m.child().WithContext(ctx)
+			data, res := core.Invoke(meta, item.Name, item.Value, item.Setting)
+			m.adopt(meta)
+
+			results[i].Data, results[i].Res = data, res
+			if batch.FailFast && res != nil && res.Fail() {
+				cancel()
+			}
+		}(i, item)
+	}
+	wg.Wait()
+
+	var failed Res
+	for _, item := range results {
+		if item.Res != nil && item.Res.Fail() {
+			failed = item.Res
+			break
+		}
+	}
+	m.Result(failed)
+	return results
+}
+
+// InvokeAll runs keyed invocations concurrently, results use the same keys.
+func (m *Meta) InvokeAll(invocations map[string]Invocation, batches ...Batch) map[string]Invoked {
+	keys := make([]string, 0, len(invocations))
+	list := make([]Invocation, 0, len(invocations))
+	for key, item := range invocations {
+		keys = append(keys, key)
+		list = append(list, item)
+	}
+
+	results := m.InvokeBatch(list, batches...)
+
+	out := make(map[string]Invoked, len(results))
+	for i, item := range results {
+		out[keys[i]] = item
+	}
+	return out
+}
+
+// InvokeBatch runs invocations concurrently with meta.
+func InvokeBatch(meta *Meta, invocations []Invocation, batches ...Batch) []Invoked {
+	if meta == nil {
+		meta = NewMeta()
+	}
+	return meta.InvokeBatch(invocations, batches...)
+}
+
+// InvokeAll runs keyed invocations concurrently with meta.
+func InvokeAll(meta *Meta, invocations map[string]Invocation, batches ...Batch) map[string]Invoked {
+	if meta == nil {
+		meta = NewMeta()
+	}
+	return meta.InvokeAll(invocations, batches...)
+}
@@ -0,0 +1,222 @@
+package bamgoo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	CLOSED   = "closed"
+	OPEN     = "open"
+	HALFOPEN = "half-open"
+)
+
+var breaker = &breakerModule{
+	config: breakerConfig{
+		Enable:   true,
+		Window:   10 * time.Second,
+		Requests: 20,
+		Ratio:    0.5,
+		Slow:     0,
+		Sleep:    30 * time.Second,
+		Probes:   1,
+	},
+	breakers: make(map[string]*circuit, 0),
+}
+
+type (
+	// breakerModule trips remote services by error rate and latency.
+	// Config example:
+	// [breaker]
+	// window = "10s"    # counting window
+	// requests = 20     # min requests in window before tripping
+	// ratio = 0.5       # failure ratio to trip
+	// slow = "2s"       # calls slower than this count as failures, 0 disables
+	// sleep = "30s"     # how long the breaker stays open
+	// probes = 1        # trial calls allowed when half-open
+	breakerModule struct {
+		mutex    sync.Mutex
+		config   breakerConfig
+		breakers map[string]*circuit
+	}
+	breakerConfig struct {
+		Enable   bool
+		Window   time.Duration
+		Requests int
+		Ratio    float64
+		Slow     time.Duration
+		Sleep    time.Duration
+		Probes   int
+	}
+
+	circuit struct {
+		state    string
+		start    time.Time
+		opened   time.Time
+		requests int
+		failures int
+		probes   int
+	}
+)
+
+func (m *breakerModule) Register(string, Any) {}
+
+// Config loads breaker config.
+func (m *breakerModule) Config(global Map) {
+	cfg, ok := global["breaker"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if vv, ok := cfg["enable"].(bool); ok {
+		m.config.Enable = vv
+	}
+	if vv, ok := parseDuration(cfg["window"]); ok && vv > 0 {
+		m.config.Window = vv
+	}
+	if vv, ok := cfg["requests"].(int64); ok {
+		m.config.Requests = int(vv)
+	}
+	if vv, ok := cfg["requests"].(int); ok {
+		m.config.Requests = vv
+	}
+	if vv, ok := cfg["ratio"].(float64); ok {
+		m.config.Ratio = vv
+	}
+	if vv, ok := parseDuration(cfg["slow"]); ok {
+		m.config.Slow = vv
+	}
+	if vv, ok := parseDuration(cfg["sleep"]); ok && vv > 0 {
+		m.config.Sleep = vv
+	}
+	if vv, ok := cfg["probes"].(int64); ok && vv > 0 {
+		m.config.Probes = int(vv)
+	}
+	if vv, ok := cfg["probes"].(int); ok && vv > 0 {
+		m.config.Probes = vv
+	}
+}
+
+func (m *breakerModule) Setup() {}
+func (m *breakerModule) Open()  {}
+func (m *breakerModule) Start() {}
+func (m *breakerModule) Stop()  {}
+func (m *breakerModule) Close() {}
+
+// Allow reports whether a call to name may go out.
+func (m *breakerModule) Allow(name string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.config.Enable {
+		return true
+	}
+
+	now := time.Now()
+	c := m.circuit(name, now)
+	switch c.state {
+	case OPEN:
+		if now.Sub(c.opened) < m.config.Sleep {
+			return false
+		}
+		c.state, c.probes = HALFOPEN, 0
+		fallthrough
+	case HALFOPEN:
+		if c.probes >= m.config.Probes {
+			return false
+		}
+		c.probes++
+	}
+	return true
+}
+
+// Done records the outcome of a call allowed by Allow.
+func (m *breakerModule) Done(name string, res Res, latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.config.Enable {
+		return
+	}
+
+	now := time.Now()
+	c := m.circuit(name, now)
+	failed := m.failed(res, latency)
+
+	switch c.state {
+	case HALFOPEN:
+		if failed {
+			c.state, c.opened = OPEN, now
+			return
+		}
+		c.probes--
+		if c.probes <= 0 {
+			c.state, c.start, c.requests, c.failures = CLOSED, now, 0, 0
+		}
+	case CLOSED:
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= m.config.Requests && float64(c.failures)/float64(c.requests) >= m.config.Ratio {
+			c.state, c.opened = OPEN, now
+		}
+	}
+}
+
+// failed counts transport errors, timeouts, panics and slow calls as failures,
+// business failures returned by the service do not trip the breaker, neither
+// do calls cancelled by the caller or names no node serves.
+func (m *breakerModule) failed(res Res, latency time.Duration) bool {
+	if m.config.Slow > 0 && latency >= m.config.Slow {
+		return true
+	}
+	if res == nil || res.OK() {
+		return false
+	}
+	switch res.Code() {
+	case -1:
+		state := res.State()
+		return state != context.Canceled.Error() &&
+			!strings.HasPrefix(state, errServiceMissing.Error()) && !strings.HasPrefix(state, errNoRoute.Error())
+	case Timeout.Code(), Panic.Code(), Unavailable.Code():
+		return true
+	}
+	return false
+}
+
+// circuit returns the breaker of name, resetting the closed window when expired.
+func (m *breakerModule) circuit(name string, now time.Time) *circuit {
+	c, ok := m.breakers[name]
+	if !ok {
+		c = &circuit{state: CLOSED, start: now}
+		m.breakers[name] = c
+	}
+	if c.state == CLOSED && now.Sub(c.start) >= m.config.Window {
+		c.start, c.requests, c.failures = now, 0, 0
+	}
+	return c
+}
+
+// States returns breaker state of every service that has been called.
+func (m *breakerModule) States() map[string]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	states := make(map[string]string, len(m.breakers))
+	for name, c := range m.breakers {
+		state := c.state
+		if state == OPEN && time.Since(c.opened) >= m.config.Sleep {
+			state = HALFOPEN
+		}
+		states[name] = state
+	}
+	return states
+}
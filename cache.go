@@ -0,0 +1,276 @@
+package bamgoo
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const defaultCacheSize = 10000
+
+var cacher = &cacheModule{}
+
+type (
+	// CacheItem is a cached invocation result.
+	CacheItem struct {
+		Data  Map
+		Code  int
+		State string
+		Args  []Any
+	}
+
+	// cacheModule caches results of entries with Setting["cache"], which accepts
+	// a ttl like "5m", or Map{"ttl": "5m", "negative": "10s", "fields": []Any{"language"}}.
+	// negative is the ttl of failed results, fields are meta fields added to the key:
+	// language, timezone, token, tokenid.
+	cacheModule struct{}
+
+	cachePolicy struct {
+		TTL      time.Duration
+		Negative time.Duration
+		Fields   []string
+	}
+
+	// memoryCache is the default in-memory LRU cache store.
+	memoryCache struct {
+		mutex sync.Mutex
+		size  int
+		items map[string]*list.Element
+		order *list.List
+	}
+	memoryCacheEntry struct {
+		key     string
+		item    CacheItem
+		expires time.Time
+	}
+)
+
+func (m *cacheModule) Register(string, Any) {}
+
+// Config resizes the default memory store.
+func (m *cacheModule) Config(global Map) {
+	cfg, ok := global["cache"].(Map)
+	if !ok {
+		return
+	}
+	size := 0
+	switch vv := cfg["size"].(type) {
+	case int:
+		size = vv
+	case int64:
+		size = int(vv)
+	}
+	if size > 0 {
+		hook.mutex.RLock()
+		store, ok := hook.cache.(*memoryCache)
+		hook.mutex.RUnlock()
+		if ok {
+			store.Resize(size)
+		}
+	}
+}
+
+func (m *cacheModule) Setup() {}
+func (m *cacheModule) Open()  {}
+func (m *cacheModule) Start() {}
+func (m *cacheModule) Stop()  {}
+func (m *cacheModule) Close() {}
+
+// policy reads the cache policy from ctx.Setting["cache"].
+func (m *cacheModule) policy(ctx *Context) (cachePolicy, bool) {
+	policy := cachePolicy{}
+	switch vv := ctx.Setting["cache"].(type) {
+	case Map:
+		policy.TTL, _ = parseDuration(vv["ttl"])
+		policy.Negative, _ = parseDuration(vv["negative"])
+		switch fields := vv["fields"].(type) {
+		case []string:
+			policy.Fields = fields
+		case []Any:
+			for _, field := range fields {
+				if str, ok := field.(string); ok {
+					policy.Fields = append(policy.Fields, str)
+				}
+			}
+		}
+	default:
+		policy.TTL, _ = parseDuration(vv)
+	}
+	return policy, policy.TTL > 0
+}
+
+// key derives cache key from name, version, canonicalized value and meta fields.
+func (m *cacheModule) key(ctx *Context, policy cachePolicy) (string, bool) {
+	value := ctx.Value
+	if value == nil {
+		value = Map{}
+	}
+	// json sorts map keys, so equal values always encode the same
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+
+	hash := sha1.New()
+	hash.Write(canonical)
+	for _, field := range policy.Fields {
+		hash.Write([]byte{0})
+		switch strings.ToLower(field) {
+		case "language", "lang":
+			hash.Write([]byte(ctx.Language()))
+		case "timezone":
+			_, offset := time.Now().In(ctx.Timezone()).Zone()
+			hash.Write([]byte(strconv.Itoa(offset)))
+		case "token":
+			hash.Write([]byte(ctx.Token()))
+		case "tokenid", "id":
+			hash.Write([]byte(ctx.TokenId()))
+		}
+	}
+
+	name := ctx.Name
+	if ctx.Version != "" {
+		name += "@" + ctx.Version
+	}
+	return name + "|" + hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// Load returns a cached result.
+func (m *cacheModule) Load(key string) (Map, Res, bool) {
+	item, ok := hook.LoadCache(key)
+	if !ok {
+		return nil, nil, false
+	}
+
+	data := make(Map, len(item.Data))
+	for k, v := range item.Data {
+		data[k] = v
+	}
+	if item.Code == 0 && item.State == "" {
+		return data, nil, true
+	}
+	return data, &result{item.Code, item.State, item.Args, false}, true
+}
+
+// Store caches a result, failures only with negative ttl.
+// Timeouts, panics and limits are never cached.
+func (m *cacheModule) Store(key string, policy cachePolicy, data Map, res Res) {
+	ttl := policy.TTL
+	item := CacheItem{Data: make(Map, len(data))}
+	for k, v := range data {
+		item.Data[k] = v
+	}
+	if res != nil {
+		item.Code, item.State, item.Args = res.Code(), res.State(), res.Args()
+	}
+
+	if res != nil && res.Fail() {
+		switch res.Code() {
+		case -1, Retry.Code(), Timeout.Code(), Panic.Code(), Unavailable.Code(), Limited.Code():
+			return
+		}
+		ttl = policy.Negative
+	}
+	if ttl <= 0 {
+		return
+	}
+	hook.StoreCache(key, item, ttl)
+}
+
+// Delete removes cached results of name for the value, name is resolved
+// like an invocation, so "user.get" removes results of the latest version.
+func (m *cacheModule) Delete(meta *Meta, name string, value Map, fields ...string) {
+	if meta == nil {
+		meta = NewMeta()
+	}
+	_, resolved, found := core.resolve(name)
+	name, version := splitVersion(name)
+	if found {
+		version = resolved
+	}
+	ctx := &Context{Meta: meta, Name: name, Version: version, Value: value}
+	if key, ok := m.key(ctx, cachePolicy{Fields: fields}); ok {
+		hook.DeleteCache(key)
+	}
+}
+
+func newMemoryCache(size int) *memoryCache {
+	return &memoryCache{
+		size:  size,
+		items: make(map[string]*list.Element, 0),
+		order: list.New(),
+	}
+}
+
+func (c *memoryCache) LoadCache(key string) (CacheItem, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return CacheItem{}, false
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return CacheItem{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.item, true
+}
+
+func (c *memoryCache) StoreCache(key string, item CacheItem, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*memoryCacheEntry)
+		entry.item, entry.expires = item, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&memoryCacheEntry{key, item, expires})
+	c.evict()
+}
+
+func (c *memoryCache) DeleteCache(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Resize changes capacity, evicting the least recently used items.
+func (c *memoryCache) Resize(size int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.size = size
+	c.evict()
+}
+
+func (c *memoryCache) evict() {
+	for c.size > 0 && c.order.Len() > c.size {
+		elem := c.order.Back()
+		c.order.Remove(elem)
+		delete(c.items, elem.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// Uncache removes the cached result of name for value,
+// fields must match the meta fields of the cache setting.
+func Uncache(meta *Meta, name string, value Map, fields ...string) {
+	cacher.Delete(meta, name, value, fields...)
+}
@@ -184,6 +184,7 @@ func (module *codecModule) Sequence() int64 {
 	if module.fastid == nil {
 		module.Setup()
 	}
+	metrics.ids.Add(1)
 	return module.fastid.NextID()
 }
 
@@ -54,11 +54,15 @@ func (m *Meta) WithContext(ctx context.Context) *Meta {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	m.mutex.Lock()
 	m.ctx = ctx
+	m.mutex.Unlock()
 	return m
 }
 
 func (m *Meta) Context() context.Context {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	if m.ctx == nil {
 		return context.Background()
 	}
@@ -231,16 +235,29 @@ func (m *Meta) TempDir(patterns ...string) (string, error) {
 
 // Invoke calls another service (local first, then bus).
 // It stores the result in meta and returns only the data.
+// Maps after the value are used as invoke settings.
 func (m *Meta) Invoke(name string, values ...Map) Map {
 	var value Map
+	var settings []Map
 	if len(values) > 0 {
 		value = values[0]
+		settings = values[1:]
 	}
-	data, res := core.Invoke(m, name, value)
+	data, res := core.Invoke(m, name, value, settings...)
 	m.result = res
 	return data
 }
 
+// Publish broadcasts an event through the bus.
+func (m *Meta) Publish(name string, values ...Map) error {
+	return Publish(m, name, values...)
+}
+
+// Enqueue sends a message to the queue through the bus.
+func (m *Meta) Enqueue(name string, values ...Map) error {
+	return Enqueue(m, name, values...)
+}
+
 // CloseMeta should be called after request finishes to cleanup meta.
 func CloseMeta(meta *Meta) {
 	if meta == nil {
@@ -268,11 +285,40 @@ func tempDir(patterns ...string) (string, error) {
 }
 
 // Context carries invocation data for method/service.
+// Config is nil when the invocation is routed to the bus.
+// Args holds the value mapped by Config.Args before the action runs.
+// Version is the resolved version when Name is registered with versions.
+// Attempt counts the current attempt under the retry policy, starting from 1.
 type Context struct {
 	*Meta
 
 	Name    string
+	Version string
+	Attempt int
 	Config  *coreEntry
 	Setting Map
 	Value   Map
+	Args    Map
+
+	ctx  context.Context
+	span *Span
+}
+
+// Context returns the context of the current attempt, which carries
+// the invocation deadline, or the meta context outside an attempt.
+func (ctx *Context) Context() context.Context {
+	if ctx.ctx != nil {
+		return ctx.ctx
+	}
+	return ctx.Meta.Context()
+}
+
+// Invoke calls another service under the deadline of this invocation.
+// It stores the result in meta and returns only the data.
+func (ctx *Context) Invoke(name string, values ...Map) Map {
+	meta := ctx.Meta.child().WithContext(ctx.Context())
+	data := meta.Invoke(name, values...)
+	ctx.Meta.adopt(meta)
+	ctx.Meta.result = meta.result
+	return data
 }
@@ -1,9 +1,13 @@
 package bamgoo
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,16 +18,32 @@ import (
 const defaultCallTimeout = 5 * time.Second
 
 var core = &coreModule{
-	entries: make(map[string]coreEntry, 0),
+	config: coreConfig{
+		Timeout: defaultCallTimeout,
+		Retry:   defaultRetryPolicy(),
+	},
+	entries:  make(map[string]coreEntry, 0),
+	versions: make(map[string][]string, 0),
 }
 
 type (
 	coreModule struct {
-		mutex   sync.RWMutex
-		entries map[string]coreEntry
+		mutex        sync.RWMutex
+		config       coreConfig
+		entries      map[string]coreEntry
+		versions     map[string][]string
+		interceptors []Interceptor
+	}
+	// coreConfig.Timeout limits remote calls, Local limits local calls and
+	// is only set when core timeout is configured.
+	coreConfig struct {
+		Timeout time.Duration
+		Local   time.Duration
+		Retry   retryPolicy
 	}
 	coreEntry struct {
-		remote bool
+		remote  bool
+		library string
 
 		Name     string
 		Desc     string
@@ -34,6 +54,21 @@ type (
 	}
 )
 type (
+	// Entry describes a registered method or service.
+	// Remote is true for services, which are reachable through the bus.
+	// Library is the prefix of the owning library, if any.
+	// Version is parsed from names like "user.get@1.2.0".
+	Entry struct {
+		Name     string
+		Version  string
+		Desc     string
+		Nullable bool
+		Args     Vars
+		Setting  Map
+		Remote   bool
+		Library  string
+	}
+
 	Methods map[string]Method
 	Method  struct {
 		Name     string
@@ -64,6 +99,8 @@ func (e *coreModule) Register(name string, value Any) {
 		e.RegisterMethods(name, v)
 	case Services:
 		e.RegisterServices(name, v)
+	case Interceptor:
+		e.RegisterInterceptor(name, v)
 	}
 }
 
@@ -88,53 +125,149 @@ func (e *coreModule) RegisterServices(prefix string, services Services) {
 }
 
 func (e *coreModule) RegisterMethod(name string, method Method) {
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-
-	if name == "" {
-		return
-	}
-
-	if _, ok := e.entries[name]; ok {
-		panic("method already registered: " + name)
-	}
+	e.registerMethod(name, method, "")
+}
 
-	e.entries[name] = coreEntry{
+func (e *coreModule) registerMethod(name string, method Method, library string) {
+	e.store(name, coreEntry{
 		remote:   false,
+		library:  library,
 		Name:     name,
 		Desc:     method.Desc,
 		Nullable: method.Nullable,
 		Args:     method.Args,
 		Action:   method.Action,
 		Setting:  method.Setting,
-	}
+	}, Override())
 }
 
 func (e *coreModule) RegisterService(name string, service Service) {
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
+	e.store(name, e.serviceEntry(name, service), Override())
+}
 
-	if name == "" {
-		return
-	}
-	if _, ok := e.entries[name]; ok {
-		panic("service already registered: " + name)
-	}
-	e.entries[name] = coreEntry{
+func (e *coreModule) serviceEntry(name string, service Service) coreEntry {
+	return coreEntry{
 		remote:   true,
 		Name:     name,
 		Desc:     service.Desc,
 		Nullable: service.Nullable,
 		Args:     service.Args,
 		Action:   service.Action,
+		Setting:  service.Setting,
+	}
+}
+
+// store saves entry, existing entry is only replaced when override is true.
+func (e *coreModule) store(name string, entry coreEntry, override bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if name == "" {
+		return
+	}
+
+	base, version := splitVersion(name)
+	if version != "" {
+		if _, ok := parseSemver(version); !ok {
+			panic("invalid version: " + name)
+		}
+	}
+
+	if old, ok := e.entries[name]; ok {
+		if !override {
+			if entry.remote {
+				panic("service already registered: " + name)
+			}
+			panic("method already registered: " + name)
+		}
+		if entry.library == "" {
+			entry.library = old.library
+		}
+	}
+
+	e.entries[name] = entry
+	if version != "" && !slices.Contains(e.versions[base], version) {
+		e.versions[base] = append(e.versions[base], version)
+	}
+}
+
+// Replace swaps a method or service at runtime regardless of Override().
+// In-flight invocations keep running the previous action.
+func (e *coreModule) Replace(name string, value Any) {
+	switch v := value.(type) {
+	case Method:
+		e.store(name, coreEntry{
+			Name: name, Desc: v.Desc, Nullable: v.Nullable,
+			Args: v.Args, Action: v.Action, Setting: v.Setting,
+		}, true)
+	case Service:
+		e.store(name, e.serviceEntry(name, v), true)
+	default:
+		panic("invalid replacement: " + name)
+	}
+}
+
+// Unregister removes a method or service, returns whether it existed.
+func (e *coreModule) Unregister(name string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.entries[name]; !ok {
+		return false
 	}
+	delete(e.entries, name)
+
+	base, version := splitVersion(name)
+	if version != "" {
+		e.versions[base] = slices.DeleteFunc(e.versions[base], func(v string) bool {
+			return v == version
+		})
+		if len(e.versions[base]) == 0 {
+			delete(e.versions, base)
+		}
+	}
+	return true
+}
+
+// resolve finds the entry for name, "user.get@^1" or "user.get" picks
+// the highest matching version, plain name prefers an unversioned entry.
+// Returns the entry and its resolved version.
+func (e *coreModule) resolve(name string) (coreEntry, string, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if entry, ok := e.entries[name]; ok {
+		_, version := splitVersion(name)
+		return entry, version, true
+	}
+
+	base, constraint := splitVersion(name)
+	best, ok := latestVersion(e.versions[base], constraint)
+	if !ok {
+		return coreEntry{}, "", false
+	}
+
+	entry, ok := e.entries[base+"@"+best]
+	return entry, best, ok
 }
 
-func (e *coreModule) Config(Map) {}
-func (e *coreModule) Setup()     {}
-func (e *coreModule) Open()      {}
+// Config loads core config.
+func (e *coreModule) Config(global Map) {
+	cfg, ok := global["core"].(Map)
+	if !ok {
+		return
+	}
+	if vv, ok := parseDuration(cfg["timeout"]); ok && vv > 0 {
+		e.config.Timeout, e.config.Local = vv, vv
+	}
+	if vv, ok := cfg["retry"]; ok {
+		e.config.Retry = parseRetryPolicy(e.config.Retry, vv)
+	}
+}
+func (e *coreModule) Setup() {}
+func (e *coreModule) Open()  {}
 func (e *coreModule) Start() {
-	fmt.Println("core module is running.")
+	logger.Logger("core").Info("core module is running")
 }
 func (e *coreModule) Stop()  {}
 func (e *coreModule) Close() {}
@@ -146,37 +279,263 @@ func (e *coreModule) Wait() {
 	<-waiter
 }
 
+// Entries returns registered methods and services, trigger and subscriber methods are excluded.
+func (e *coreModule) Entries() map[string]Entry {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	entries := make(map[string]Entry, len(e.entries))
+	for name, entry := range e.entries {
+		if strings.HasPrefix(name, "_.") || strings.HasPrefix(name, eventPrefix) {
+			continue
+		}
+		entries[name] = entry.info()
+	}
+	return entries
+}
+
+func (entry *coreEntry) info() Entry {
+	args := make(Vars, len(entry.Args))
+	for k, v := range entry.Args {
+		args[k] = v
+	}
+	setting := make(Map, len(entry.Setting))
+	for k, v := range entry.Setting {
+		setting[k] = v
+	}
+	_, version := splitVersion(entry.Name)
+	return Entry{
+		Name: entry.Name, Version: version, Desc: entry.Desc,
+		Nullable: entry.Nullable, Args: args, Setting: setting,
+		Remote: entry.remote, Library: entry.library,
+	}
+}
+
 // Invoke calls a method/service (local first, then remote via bus).
 func (e *coreModule) Invoke(meta *Meta, name string, value Map, settings ...Map) (Map, Res) {
 	if data, res, ok := e.invokeLocal(meta, name, value, settings...); ok {
 		return data, res
 	}
-	return e.invokeRemote(meta, name, value)
+	return e.invokeRemote(meta, name, value, settings...)
 }
 
 // localInvoke only calls local method/service, does not go through bus.
 // Returns (data, res, found) where found indicates if local entry exists.
 func (e *coreModule) invokeLocal(meta *Meta, name string, value Map, settings ...Map) (Map, Res, bool) {
-	e.mutex.RLock()
-	entry, ok := e.entries[name]
-	e.mutex.RUnlock()
-
+	entry, version, ok := e.resolve(name)
 	if !ok || entry.Action == nil {
 		return nil, nil, false
 	}
 
+	name, _ = splitVersion(name)
+	ctx := e.newContext(meta, name, value, &entry, settings...)
+	ctx.Version = version
+	data, res := e.execute(ctx, func(ctx *Context) (Map, Res) {
+		if res := e.mapping(ctx); res != nil && res.Fail() {
+			return nil, res
+		}
+		return entry.Action(ctx)
+	})
+	return data, res, true
+}
+
+// mapping validates ctx.Value against entry args and fills ctx.Args.
+func (e *coreModule) mapping(ctx *Context) Res {
+	ctx.Args = Map{}
+	if ctx.Config == nil || len(ctx.Config.Args) == 0 {
+		return nil
+	}
+	return basic.Mapping(ctx.Config.Args, ctx.Value, ctx.Args, ctx.Config.Nullable, false, ctx.Timezone())
+}
+
+// remoteInvoke calls remote service via bus.
+func (e *coreModule) invokeRemote(meta *Meta, name string, value Map, settings ...Map) (Map, Res) {
+	ctx := e.newContext(meta, name, value, nil, settings...)
+	return e.execute(ctx, func(ctx *Context) (Map, Res) {
+		timeout := e.config.Timeout
+		if deadline, ok := ctx.Context().Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		if !breaker.Allow(ctx.Name) {
+			return nil, Unavailable
+		}
+		// a panicking bus still has to release the half-open probe
+		start, res := time.Now(), Res(Panic)
+		defer func() {
+			breaker.Done(ctx.Name, res, time.Since(start))
+		}()
+		data, res := hook.Request(ctx.Meta, ctx.Name, ctx.Value, timeout)
+		return data, res
+	})
+}
+
+// execute runs the invocation in its own span and records it into statistics.
+func (e *coreModule) execute(ctx *Context, action InvokeFunc) (Map, Res) {
+	kind, name := INVOKE, ctx.Name
+	if ctx.Config != nil && ctx.Config.library != "" {
+		kind = LIBRARY
+	}
+	if ctx.Version != "" {
+		name += "@" + ctx.Version
+	}
+	ctx.span = tracer.Begin(ctx.Meta, kind, name)
+
+	start := time.Now()
+	data, res := e.retry(ctx, action)
+	statistics.Record(ctx.Name, ctx.Version, res, time.Since(start))
+
+	tracer.Finish(ctx.Meta, ctx.span, res)
+	return data, res
+}
+
+// cache serves the invocation from cache when Setting["cache"] is set.
+// It runs inside the interceptor chain, so cached results pass interceptors too.
+func (e *coreModule) cache(ctx *Context, action InvokeFunc) (Map, Res) {
+	policy, ok := cacher.policy(ctx)
+	if !ok {
+		return action(ctx)
+	}
+	key, ok := cacher.key(ctx, policy)
+	if !ok {
+		return action(ctx)
+	}
+	if data, res, ok := cacher.Load(key); ok {
+		return data, res
+	}
+
+	data, res := action(ctx)
+	cacher.Store(key, policy, data, res)
+	return data, res
+}
+
+// retry runs the invocation with the retry policy from ctx.Setting["retry"].
+// Every attempt gets a copy of ctx with Attempt set, starting from 1.
+func (e *coreModule) retry(ctx *Context, action InvokeFunc) (Map, Res) {
+	policy := e.config.Retry
+	if vv, ok := ctx.Setting["retry"]; ok {
+		policy = parseRetryPolicy(policy, vv)
+	}
+
+	for attempt := 1; ; attempt++ {
+		current := *ctx
+		current.Attempt = attempt
+
+		data, res := e.attempt(&current, action)
+		if attempt >= policy.Attempts || !policy.retryable(res) {
+			return data, res
+		}
+
+		select {
+		case <-time.After(policy.backoff(attempt)):
+		case <-ctx.Context().Done():
+			return data, res
+		}
+	}
+}
+
+// attempt runs the interceptor chain and action under the invocation deadline.
+// The deadline is kept on ctx, the meta of the caller is never changed.
+// The caller gets a Timeout result once the deadline passes, the action keeps
+// running in background and should watch ctx.Context().Done() to stop early.
+func (e *coreModule) attempt(ctx *Context, action InvokeFunc) (Map, Res) {
+	parent := ctx.Context()
+	var current context.Context
+	var cancel context.CancelFunc
+	if timeout, ok := e.timeout(ctx, parent); ok {
+		current, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		current, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	ctx.ctx = current
+
+	type result struct {
+		data Map
+		res  Res
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, res := e.recover(ctx, action)
+		done <- result{data, res}
+	}()
+
+	select {
+	case out := <-done:
+		return out.data, out.res
+	case <-current.Done():
+		tracer.resume(ctx.Meta, ctx.span)
+		return nil, contextResult(current.Err())
+	}
+}
+
+// contextResult converts context error into Res, deadline becomes Timeout.
+func contextResult(err error) Res {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	return errorResult(err)
+}
+
+// recover runs the interceptor chain, cache, limiter and action, turning a panic into Panic result.
+func (e *coreModule) recover(ctx *Context, action InvokeFunc) (data Map, res Res) {
+	defer func() {
+		if value := recover(); value != nil {
+			stack := debug.Stack()
+			hook.ReportPanic(ctx.Meta, ctx.Name, value, stack)
+			data, res = nil, Panic.With(value, string(stack))
+		}
+	}()
+	return e.intercept(ctx, func(ctx *Context) (Map, Res) {
+		return e.cache(ctx, func(ctx *Context) (Map, Res) {
+			return e.limit(ctx, action)
+		})
+	})
+}
+
+// limit runs the action under the limit policy of ctx, it sits behind the
+// cache, so results served from cache take no tokens or bulkhead slots.
+func (e *coreModule) limit(ctx *Context, action InvokeFunc) (Map, Res) {
+	release, res := limiter.Acquire(ctx)
+	if res != nil {
+		return nil, res
+	}
+	defer release()
+	return action(ctx)
+}
+
+// timeout resolves invocation timeout from caller deadline, setting and config.
+// The caller deadline always wins when it comes first, without any of them
+// the invocation has no time limit.
+func (e *coreModule) timeout(ctx *Context, parent context.Context) (time.Duration, bool) {
+	timeout := e.config.Local
+	if vv, ok := parseDuration(ctx.Setting["timeout"]); ok && vv > 0 {
+		timeout = vv
+	}
+	if deadline, ok := parent.Deadline(); ok {
+		if remain := time.Until(deadline); timeout <= 0 || remain < timeout {
+			return remain, true
+		}
+	}
+	return timeout, timeout > 0
+}
+
+// newContext builds the invocation context, settings override entry setting.
+func (e *coreModule) newContext(meta *Meta, name string, value Map, entry *coreEntry, settings ...Map) *Context {
 	if meta == nil {
 		meta = NewMeta()
 	}
 	ctx := &Context{
 		Meta:    meta,
 		Name:    name,
-		Config:  &entry,
+		Config:  entry,
 		Setting: Map{},
 		Value:   value,
 	}
-	for k, v := range entry.Setting {
-		ctx.Setting[k] = v
+	if entry != nil {
+		for k, v := range entry.Setting {
+			ctx.Setting[k] = v
+		}
 	}
 	for _, setting := range settings {
 		if setting == nil {
@@ -186,14 +545,96 @@ func (e *coreModule) invokeLocal(meta *Meta, name string, value Map, settings ..
 			ctx.Setting[k] = v
 		}
 	}
-	data, res := entry.Action(ctx)
-	return data, res, true
+	return ctx
 }
 
-// remoteInvoke calls remote service via bus.
-func (e *coreModule) invokeRemote(meta *Meta, name string, value Map) (Map, Res) {
+// Entries returns all registered methods and services.
+func Entries() map[string]Entry {
+	return core.Entries()
+}
+
+// Replace swaps a method or service at runtime regardless of Override().
+func Replace(name string, value Any) {
+	core.Replace(name, value)
+}
+
+// Unregister removes a method or service, returns whether it existed.
+func Unregister(name string) bool {
+	return core.Unregister(name)
+}
+
+// Invoke calls a method/service with meta, settings override entry setting.
+func Invoke(meta *Meta, name string, value Map, settings ...Map) (Map, Res) {
+	return core.Invoke(meta, name, value, settings...)
+}
+
+// Publish broadcasts an event through the bus.
+func Publish(meta *Meta, name string, values ...Map) error {
+	value := Map{}
+	if len(values) > 0 && values[0] != nil {
+		value = values[0]
+	}
+	if meta == nil {
+		meta = NewMeta()
+	}
+	span := tracer.Begin(meta, PUBLISH, name)
+	err := hook.Publish(meta, name, value)
+	tracer.Finish(meta, span, resultOf(err))
+	return err
+}
+
+// Enqueue sends a message to the queue through the bus, deliveries
+// are retried by the retry policy of the entry setting.
+func Enqueue(meta *Meta, name string, values ...Map) error {
+	value := Map{}
+	if len(values) > 0 && values[0] != nil {
+		value = values[0]
+	}
 	if meta == nil {
 		meta = NewMeta()
 	}
-	return hook.Request(meta, name, value, defaultCallTimeout)
+	span := tracer.Begin(meta, ENQUEUE, name)
+	err := hook.Enqueue(meta, name, value)
+	tracer.Finish(meta, span, resultOf(err))
+	return err
+}
+
+// resultOf converts error into Res, nil stays nil.
+func resultOf(err error) Res {
+	if err == nil {
+		return nil
+	}
+	return errorResult(err)
+}
+
+// parseInt converts config numbers into int.
+func parseInt(value Any) (int, bool) {
+	switch vv := value.(type) {
+	case int:
+		return vv, true
+	case int64:
+		return int(vv), true
+	case float64:
+		return int(vv), true
+	}
+	return 0, false
+}
+
+// parseDuration converts duration, "5s" style string or seconds into time.Duration.
+func parseDuration(value Any) (time.Duration, bool) {
+	switch vv := value.(type) {
+	case time.Duration:
+		return vv, true
+	case int:
+		return time.Duration(vv) * time.Second, true
+	case int64:
+		return time.Duration(vv) * time.Second, true
+	case float64:
+		return time.Duration(vv * float64(time.Second)), true
+	case string:
+		if d, err := time.ParseDuration(vv); err == nil {
+			return d, true
+		}
+	}
+	return 0, false
 }
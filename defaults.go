@@ -3,6 +3,7 @@ package bamgoo
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +17,8 @@ type defaultBusHook struct{}
 
 type defaultConfigHook struct{}
 
+type defaultPanicHook struct{}
+
 func (h *defaultBusHook) Request(meta *Meta, name string, value base.Map, _ time.Duration) (base.Map, base.Res) {
 	data, res, ok := core.invokeLocal(meta, name, value)
 	if ok {
@@ -25,19 +28,26 @@ func (h *defaultBusHook) Request(meta *Meta, name string, value base.Map, _ time
 }
 
 func (h *defaultBusHook) Publish(meta *Meta, name string, value base.Map) error {
-	_, _, _ = core.invokeLocal(meta, name, value)
+	events.Publish(meta, name, value)
 	return nil
 }
 
 func (h *defaultBusHook) Enqueue(meta *Meta, name string, value base.Map) error {
-	go core.invokeLocal(meta, name, value)
-	return nil
+	return queues.Enqueue(meta, name, value)
 }
 
 func (h *defaultBusHook) Stats() []ServiceStats {
 	return nil
 }
 
+func (h *defaultPanicHook) ReportPanic(meta *Meta, name string, value base.Any, stack []byte) {
+	log := logger.Logger("panic")
+	if meta != nil {
+		log = log.With(meta.logAttrs()...)
+	}
+	log.Error("panic in "+name, "method", name, "value", fmt.Sprint(value), "stack", string(stack))
+}
+
 func (h *defaultConfigHook) LoadConfig() (base.Map, error) {
 	drvName, params, err := parseConfigParams()
 	if err != nil {
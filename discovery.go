@@ -0,0 +1,587 @@
+package bamgoo
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	ROUNDROBIN    = "round-robin"
+	LEASTINFLIGHT = "least-inflight"
+	HASH          = "hash"
+
+	hashReplicas = 64
+)
+
+var discovery = &discoveryModule{
+	config: discoveryConfig{
+		Driver: MEMORY, Dir: "data/nodes",
+		Heartbeat: 5 * time.Second, TTL: 15 * time.Second,
+		Balancer: ROUNDROBIN,
+	},
+	balancers: map[string]Balancer{
+		ROUNDROBIN:    &roundRobinBalancer{},
+		LEASTINFLIGHT: &leastInflightBalancer{},
+		HASH:          &hashBalancer{},
+	},
+	routes:   make(map[string]Balancer, 0),
+	inflight: make(map[string]*atomic.Int64, 0),
+}
+
+type (
+	// Node is a running bamgoo process and the services it serves.
+	Node struct {
+		Name     string    `json:"name"`
+		Role     string    `json:"role"`
+		Node     string    `json:"node"`
+		Version  string    `json:"version"`
+		Address  string    `json:"address"`
+		Services []string  `json:"services"`
+		Updated  time.Time `json:"updated"`
+	}
+
+	// Balancer picks the node of a remote call, nodes is never empty.
+	Balancer interface {
+		Select(name string, value Map, nodes []Node) Node
+	}
+
+	// discoveryModule announces this node with heartbeats and routes remote
+	// calls of the network bus to nodes serving them.
+	// Config example:
+	// [discovery]
+	// driver = "memory"               # memory, or file to share nodes through a directory
+	// dir = "data/nodes"
+	// heartbeat = "5s"
+	// ttl = "15s"                     # nodes without heartbeat for ttl are gone
+	// advertise = "127.0.0.1:7001"    # announced address, default bus listen
+	// balancer = "round-robin"        # round-robin, least-inflight, hash or a registered Balancer
+	// key = "id"                      # value key of the hash balancer
+	// [discovery.balancers]
+	// "order.*" = { balancer = "hash", key = "order_id" }
+	//
+	// More balancers are registered by name: bamgoo.Register("nearest", balancer).
+	discoveryModule struct {
+		mutex     sync.Mutex
+		config    discoveryConfig
+		balancers map[string]Balancer
+		routes    map[string]Balancer
+
+		nodes   []Node
+		fetched time.Time
+		self    Node
+
+		inflight map[string]*atomic.Int64
+		quit     chan struct{}
+		done     chan struct{}
+	}
+	discoveryConfig struct {
+		Driver    string
+		Dir       string
+		Heartbeat time.Duration
+		TTL       time.Duration
+		Advertise string
+		Balancer  string
+		Key       string
+		Balancers map[string]Map
+	}
+
+	roundRobinBalancer struct {
+		mutex sync.Mutex
+		next  map[string]int
+	}
+	leastInflightBalancer struct {
+		next atomic.Uint64
+	}
+	hashBalancer struct {
+		key string
+	}
+
+	// memoryRegistry keeps nodes inside the process.
+	memoryRegistry struct {
+		mutex sync.Mutex
+		nodes map[string]Node
+	}
+	// fileRegistry keeps each node in its own file of a shared directory,
+	// so processes on one host discover each other.
+	fileRegistry struct {
+		dir string
+	}
+)
+
+// Register adds a named Balancer.
+func (m *discoveryModule) Register(name string, value Any) {
+	balancer, ok := value.(Balancer)
+	if !ok || name == "" {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.balancers[name]; ok && !Override() {
+		panic("Balancer already registered: " + name)
+	}
+	m.balancers[name] = balancer
+}
+
+// Config loads discovery config and attaches the registry of the driver.
+func (m *discoveryModule) Config(global Map) {
+	cfg, ok := global["discovery"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if vv, ok := cfg["driver"].(string); ok && vv != "" {
+		m.config.Driver = vv
+	}
+	if vv, ok := cfg["dir"].(string); ok && vv != "" {
+		m.config.Dir = vv
+	}
+	if vv, ok := parseDuration(cfg["heartbeat"]); ok && vv > 0 {
+		m.config.Heartbeat = vv
+	}
+	if vv, ok := parseDuration(cfg["ttl"]); ok && vv > 0 {
+		m.config.TTL = vv
+	}
+	if vv, ok := cfg["advertise"].(string); ok {
+		m.config.Advertise = vv
+	}
+	if vv, ok := cfg["balancer"].(string); ok && vv != "" {
+		m.config.Balancer = vv
+	}
+	if vv, ok := cfg["key"].(string); ok {
+		m.config.Key = vv
+	}
+	if balancers, ok := cfg["balancers"].(Map); ok {
+		m.config.Balancers = make(map[string]Map, len(balancers))
+		for pattern, value := range balancers {
+			switch vv := value.(type) {
+			case string:
+				m.config.Balancers[pattern] = Map{"balancer": vv}
+			case Map:
+				m.config.Balancers[pattern] = vv
+			}
+		}
+	}
+
+	switch m.config.Driver {
+	case MEMORY:
+	case "file":
+		if err := os.MkdirAll(m.config.Dir, 0755); err != nil {
+			panic(fmt.Errorf("open discovery dir failed: %w", err))
+		}
+		hook.AttachRegistry(&fileRegistry{dir: m.config.Dir})
+	default:
+		panic("Unknown discovery driver: " + m.config.Driver)
+	}
+}
+
+// Setup resolves balancers of the config.
+func (m *discoveryModule) Setup() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.routes = make(map[string]Balancer, len(m.config.Balancers)+1)
+	m.routes["*"] = m.balancer(m.config.Balancer, m.config.Key)
+	for pattern, cfg := range m.config.Balancers {
+		name, _ := cfg["balancer"].(string)
+		key, ok := cfg["key"].(string)
+		if !ok {
+			key = m.config.Key
+		}
+		m.routes[pattern] = m.balancer(name, key)
+	}
+}
+
+// balancer returns a balancer by name, mutex must be held.
+func (m *discoveryModule) balancer(name, key string) Balancer {
+	if name == HASH {
+		return &hashBalancer{key: key}
+	}
+	if balancer, ok := m.balancers[name]; ok {
+		return balancer
+	}
+	panic("Unknown balancer: " + name)
+}
+
+// Open announces this node when the bus listens, and keeps announcing.
+func (m *discoveryModule) Open() {
+	address := m.address()
+	if address == "" {
+		return
+	}
+
+	bamgoo.mutex.RLock()
+	self := Node{
+		Name: bamgoo.name, Role: bamgoo.role, Node: bamgoo.node,
+		Version: bamgoo.version, Address: address,
+	}
+	bamgoo.mutex.RUnlock()
+
+	m.mutex.Lock()
+	m.self = self
+	m.quit, m.done = make(chan struct{}), make(chan struct{})
+	m.mutex.Unlock()
+
+	m.announce()
+	go m.heartbeat()
+}
+
+func (m *discoveryModule) Start() {}
+func (m *discoveryModule) Stop()  {}
+
+// Close stops heartbeats and withdraws this node.
+func (m *discoveryModule) Close() {
+	m.mutex.Lock()
+	quit, done, self := m.quit, m.done, m.self
+	m.quit, m.done = nil, nil
+	m.mutex.Unlock()
+
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+	if err := hook.Withdraw(self); err != nil {
+		logger.Logger("discovery").Warn("withdraw node failed", "error", err.Error())
+	}
+}
+
+// address returns the announced address.
+func (m *discoveryModule) address() string {
+	m.mutex.Lock()
+	advertise := m.config.Advertise
+	m.mutex.Unlock()
+	if advertise != "" {
+		return advertise
+	}
+
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if network.bus == nil {
+		return ""
+	}
+	return network.config.Listen
+}
+
+func (m *discoveryModule) heartbeat() {
+	m.mutex.Lock()
+	interval, quit, done := m.config.Heartbeat, m.quit, m.done
+	m.mutex.Unlock()
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.announce()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// announce publishes this node with its current services and refreshes nodes.
+func (m *discoveryModule) announce() {
+	services := make([]string, 0)
+	for name, entry := range core.Entries() {
+		if entry.Remote {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+
+	m.mutex.Lock()
+	m.self.Services = services
+	m.self.Updated = time.Now()
+	self, ttl := m.self, m.config.TTL
+	m.mutex.Unlock()
+
+	if err := hook.Announce(self, ttl); err != nil {
+		logger.Logger("discovery").Warn("announce node failed", "error", err.Error())
+	}
+	m.refresh()
+}
+
+// refresh reloads alive nodes from the registry.
+func (m *discoveryModule) refresh() []Node {
+	nodes, err := hook.Nodes()
+	if err != nil {
+		logger.Logger("discovery").Warn("load nodes failed", "error", err.Error())
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	alive := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		if time.Since(node.Updated) <= m.config.TTL {
+			alive = append(alive, node)
+		}
+	}
+	sort.Slice(alive, func(i, j int) bool { return alive[i].Address < alive[j].Address })
+	if err == nil {
+		m.nodes, m.fetched = alive, time.Now()
+	}
+	return append([]Node{}, m.nodes...)
+}
+
+// Nodes returns alive nodes, reloaded when older than a heartbeat.
+func (m *discoveryModule) Nodes() []Node {
+	m.mutex.Lock()
+	fresh := time.Since(m.fetched) < m.config.Heartbeat
+	nodes := append([]Node{}, m.nodes...)
+	ttl := m.config.TTL
+	m.mutex.Unlock()
+
+	if !fresh {
+		return m.refresh()
+	}
+	alive := nodes[:0]
+	for _, node := range nodes {
+		if time.Since(node.Updated) <= ttl {
+			alive = append(alive, node)
+		}
+	}
+	return alive
+}
+
+// route picks the address of another node serving name by the balancer of name.
+func (m *discoveryModule) route(name string, value Map) (string, bool) {
+	candidates := m.serving(name)
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	m.mutex.Lock()
+	best, balancer := -1, m.routes["*"]
+	for pattern, item := range m.routes {
+		if pattern != "*" && len(pattern) > best && (pattern == name || matchName(pattern, name)) {
+			best, balancer = len(pattern), item
+		}
+	}
+	m.mutex.Unlock()
+
+	if balancer == nil {
+		balancer = &roundRobinBalancer{}
+	}
+	return balancer.Select(name, value, candidates).Address, true
+}
+
+// serving returns other nodes serving name. Nodes with the exact name win,
+// otherwise "user.get" or "user.get@^1" resolves against announced versions
+// like core does, and only nodes with the highest matching version are kept.
+func (m *discoveryModule) serving(name string) []Node {
+	self := m.address()
+	base, constraint := splitVersion(name)
+
+	exact := make([]Node, 0)
+	versioned := make(map[string][]Node, 0)
+	for _, node := range m.Nodes() {
+		if node.Address == "" || node.Address == self {
+			continue
+		}
+		if slices.Contains(node.Services, name) {
+			exact = append(exact, node)
+			continue
+		}
+		versions := make([]string, 0)
+		for _, service := range node.Services {
+			if served, version := splitVersion(service); served == base && version != "" {
+				versions = append(versions, version)
+			}
+		}
+		if version, ok := latestVersion(versions, constraint); ok {
+			versioned[version] = append(versioned[version], node)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+
+	versions := make([]string, 0, len(versioned))
+	for version := range versioned {
+		versions = append(versions, version)
+	}
+	if version, ok := latestVersion(versions, constraint); ok {
+		return versioned[version]
+	}
+	return nil
+}
+
+// begin counts a call in flight to address, the returned func ends it.
+func (m *discoveryModule) begin(address string) func() {
+	m.mutex.Lock()
+	counter, ok := m.inflight[address]
+	if !ok {
+		counter = &atomic.Int64{}
+		m.inflight[address] = counter
+	}
+	m.mutex.Unlock()
+
+	counter.Add(1)
+	return func() { counter.Add(-1) }
+}
+
+// Inflight returns calls in flight to address.
+func (m *discoveryModule) Inflight(address string) int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if counter, ok := m.inflight[address]; ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+func (b *roundRobinBalancer) Select(name string, _ Map, nodes []Node) Node {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.next == nil {
+		b.next = make(map[string]int, 0)
+	}
+	index := b.next[name] % len(nodes)
+	b.next[name] = index + 1
+	return nodes[index]
+}
+
+// Select picks the node with fewest calls in flight, ties rotate.
+func (b *leastInflightBalancer) Select(_ string, _ Map, nodes []Node) Node {
+	offset := int(b.next.Add(1) % uint64(len(nodes)))
+	best, least := nodes[offset], discovery.Inflight(nodes[offset].Address)
+	for i := 1; i < len(nodes); i++ {
+		node := nodes[(offset+i)%len(nodes)]
+		if inflight := discovery.Inflight(node.Address); inflight < least {
+			best, least = node, inflight
+		}
+	}
+	return best
+}
+
+// Select maps the key of value onto a ring of nodes, so equal keys reach the
+// same node and only keys of a gone node move. Values without key use the name.
+func (b *hashBalancer) Select(name string, value Map, nodes []Node) Node {
+	key := name
+	if b.key != "" && value != nil {
+		if vv, ok := value[b.key]; ok {
+			key = fmt.Sprint(vv)
+		}
+	}
+
+	type point struct {
+		hash  uint32
+		index int
+	}
+	ring := make([]point, 0, len(nodes)*hashReplicas)
+	for i, node := range nodes {
+		for r := 0; r < hashReplicas; r++ {
+			ring = append(ring, point{crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", node.Address, r))), i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	at := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	if at == len(ring) {
+		at = 0
+	}
+	return nodes[ring[at].index]
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{nodes: make(map[string]Node, 0)}
+}
+
+func (r *memoryRegistry) Announce(node Node, _ time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nodes[nodeKey(node)] = node
+	return nil
+}
+
+func (r *memoryRegistry) Withdraw(node Node) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.nodes, nodeKey(node))
+	return nil
+}
+
+func (r *memoryRegistry) Nodes() ([]Node, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	nodes := make([]Node, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// Announce writes node into its file, replacing it atomically.
+func (r *fileRegistry) Announce(node Node, _ time.Duration) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	file := r.path(node)
+	temp := file + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+func (r *fileRegistry) Withdraw(node Node) error {
+	err := os.Remove(r.path(node))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Nodes reads all node files, files that can not be parsed are skipped.
+func (r *fileRegistry) Nodes() ([]Node, error) {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]Node, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		node := Node{}
+		if err := json.Unmarshal(data, &node); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (r *fileRegistry) path(node Node) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(nodeKey(node))
+	return filepath.Join(r.dir, name+".json")
+}
+
+// nodeKey identifies a node by its address, unique per running process.
+func nodeKey(node Node) string {
+	return node.Address
+}
+
+// Nodes returns alive nodes known by discovery.
+func Nodes() []Node {
+	return discovery.Nodes()
+}
@@ -0,0 +1,50 @@
+package bamgoo
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryRoutesVersionedServices(t *testing.T) {
+	nodes := []Node{
+		{Address: "127.0.0.1:9001", Services: []string{"user.get@1.2.0"}},
+		{Address: "127.0.0.1:9002", Services: []string{"user.get@2.0.0", "user.get@2.1.0-beta"}},
+		{Address: "127.0.0.1:9003", Services: []string{"order.get"}},
+	}
+	for _, node := range nodes {
+		node.Updated = time.Now()
+		if err := hook.Announce(node, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			_ = hook.Withdraw(node)
+		}
+		discovery.refresh()
+	})
+	discovery.refresh()
+
+	cases := []struct {
+		name string
+		want []string
+	}{
+		{"user.get", []string{"127.0.0.1:9002"}},
+		{"user.get@^1", []string{"127.0.0.1:9001"}},
+		{"user.get@1.2.0", []string{"127.0.0.1:9001"}},
+		{"user.get@2.1.0-beta", []string{"127.0.0.1:9002"}},
+		{"user.get@^3", nil},
+		{"order.get", []string{"127.0.0.1:9003"}},
+		{"order.get@^1", nil},
+	}
+	for _, item := range cases {
+		got := make([]string, 0)
+		for _, node := range discovery.serving(item.name) {
+			got = append(got, node.Address)
+		}
+		if !slices.Equal(got, item.want) && !(len(got) == 0 && len(item.want) == 0) {
+			t.Errorf("serving(%q) = %v, want %v", item.name, got, item.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package bamgoo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	. "github.com/bamgoo/base"
+)
+
+// eventPrefix starts the hidden method names of subscribers.
+const eventPrefix = "_event."
+
+var (
+	events = &eventModule{
+		events:      make(map[string]Event, 0),
+		subscribers: make(map[string][]Subscriber, 0),
+	}
+)
+
+type (
+	// eventModule delivers published events to local subscribers.
+	// Topics of subscribers can be patterns like "user.*".
+	eventModule struct {
+		mutex       sync.RWMutex
+		events      map[string]Event
+		subscribers map[string][]Subscriber
+		methods     []eventMethod
+		seq         uint64
+		setup       bool
+		// deprecated keeps topics already warned about method delivery
+		deprecated sync.Map
+	}
+	eventMethod struct {
+		topic  string
+		method string
+		async  bool
+	}
+
+	// Event declares a topic, for documentation and schemas.
+	Event struct {
+		Name string
+		Desc string
+		Args Vars
+	}
+
+	// Subscriber receives events of a topic, Async delivers in background.
+	// A failed subscriber never affects other subscribers or the publisher.
+	Subscriber struct {
+		Name     string
+		Desc     string
+		Nullable bool
+		Args     Vars
+		Setting  Map
+		Async    bool
+		Action   func(*Context) Res
+	}
+)
+
+func (m *eventModule) Register(name string, value Any) {
+	switch cfg := value.(type) {
+	case Event:
+		m.RegisterEvent(name, cfg)
+	case Subscriber:
+		m.RegisterSubscriber(name, cfg)
+	}
+}
+
+func (m *eventModule) RegisterEvent(name string, cfg Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if name == "" {
+		return
+	}
+	if _, ok := m.events[name]; ok && !Override() {
+		panic("event already registered: " + name)
+	}
+	m.events[name] = cfg
+}
+
+// RegisterSubscriber adds a subscriber of topic, subscribers registered
+// after setup are active at once.
+func (m *eventModule) RegisterSubscriber(topic string, cfg Subscriber) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if topic == "" || cfg.Action == nil {
+		return
+	}
+	m.subscribers[topic] = append(m.subscribers[topic], cfg)
+	if m.setup {
+		m.subscribe(topic, cfg)
+	}
+}
+
+func (m *eventModule) Config(Map) {}
+
+// Setup registers every subscriber as a hidden method, so delivery goes
+// through the invocation pipeline.
+func (m *eventModule) Setup() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for topic, subscribers := range m.subscribers {
+		for _, cfg := range subscribers {
+			m.subscribe(topic, cfg)
+		}
+	}
+	m.setup = true
+}
+func (m *eventModule) Open()  {}
+func (m *eventModule) Start() {}
+func (m *eventModule) Stop()  {}
+func (m *eventModule) Close() {}
+
+func (m *eventModule) subscribe(topic string, cfg Subscriber) {
+	m.seq++
+	method := eventPrefix + topic + "." + strconv.FormatUint(m.seq, 10)
+	action := cfg.Action // capture for closure
+	core.RegisterMethod(method, Method{
+		Name: cfg.Name, Desc: cfg.Desc,
+		Nullable: cfg.Nullable, Args: cfg.Args, Setting: cfg.Setting,
+		Action: func(ctx *Context) (Map, Res) {
+			return nil, action(ctx)
+		},
+	})
+	m.methods = append(m.methods, eventMethod{topic, method, cfg.Async})
+}
+
+// matches returns subscriber methods whose topic matches name.
+func (m *eventModule) matches(name string) []eventMethod {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	methods := make([]eventMethod, 0)
+	for _, item := range m.methods {
+		if item.topic == name || matchName(item.topic, name) {
+			methods = append(methods, item)
+		}
+	}
+	return methods
+}
+
+// Publish delivers value to all subscribers of name, synchronous subscribers
+// run in registration order before Publish returns.
+// Without subscribers the local method of the same name receives the event,
+// as before subscribers existed, this fallback is deprecated.
+func (m *eventModule) Publish(meta *Meta, name string, value Map) {
+	m.publish(meta, name, value, true)
+}
+
+// publish delivers to subscribers of name, fallback allows the deprecated
+// delivery to a method of the same name when nothing subscribes.
+func (m *eventModule) publish(meta *Meta, name string, value Map, fallback bool) {
+	if meta == nil {
+		meta = NewMeta()
+	}
+	methods := m.matches(name)
+	if len(methods) == 0 {
+		if !fallback {
+			return
+		}
+		if _, _, ok := core.invokeLocal(meta, name, value); ok {
+			if _, warned := m.deprecated.LoadOrStore(name, true); !warned {
+				logger.Logger("event").Warn("event "+name+" delivered to method of the same name, register a Subscriber instead", "topic", name)
+			}
+		}
+		return
+	}
+	for _, item := range methods {
+		child := meta.child()
+		if item.async {
+			// the delivery outlives the publisher, it keeps the values but not the cancellation
+			child.WithContext(context.WithoutCancel(meta.Context()))
+			go m.deliver(child, name, item, value)
+			continue
+		}
+		m.deliver(child, name, item, value)
+		meta.adopt(child)
+	}
+}
+
+func (m *eventModule) deliver(meta *Meta, name string, item eventMethod, value Map) {
+	_, res, _ := core.invokeLocal(meta, item.method, value)
+	if res != nil && res.Fail() {
+		log := logger.Logger("event").With(meta.logAttrs()...)
+		log.Warn("subscriber of "+name+" failed", "topic", item.topic, "code", res.Code(), "state", res.State())
+	}
+	if item.async {
+		meta.close()
+	}
+}
+
+// Events returns all declared events keyed by name.
+func (m *eventModule) Events() map[string]Event {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	events := make(map[string]Event, len(m.events))
+	for k, v := range m.events {
+		events[k] = v
+	}
+	return events
+}
+
+// Subscribers returns all subscribers keyed by topic.
+func (m *eventModule) Subscribers() map[string][]Subscriber {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	subscribers := make(map[string][]Subscriber, len(m.subscribers))
+	for k, v := range m.subscribers {
+		subscribers[k] = append([]Subscriber{}, v...)
+	}
+	return subscribers
+}
+
+// Subscribe adds a subscriber of topic at runtime.
+func Subscribe(topic string, cfg Subscriber) {
+	events.RegisterSubscriber(topic, cfg)
+}
+
+// Events returns all declared events keyed by name.
+func Events() map[string]Event {
+	return events.Events()
+}
+
+// Subscribers returns all subscribers keyed by topic.
+func Subscribers() map[string][]Subscriber {
+	return events.Subscribers()
+}
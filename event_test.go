@@ -0,0 +1,50 @@
+package bamgoo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+type eventTestKey struct{}
+
+// An async subscriber keeps running after the publisher returned and
+// cancelled its context, it still sees the values of that context.
+func TestEventAsyncOutlivesPublisher(t *testing.T) {
+	networkTestOnce.Do(func() {
+		events.Setup()
+		queues.Open()
+	})
+
+	type delivery struct {
+		err   error
+		value Any
+	}
+	delivered := make(chan delivery, 1)
+	release := make(chan struct{})
+	events.RegisterSubscriber("event.async.created", Subscriber{Async: true, Action: func(ctx *Context) Res {
+		<-release
+		delivered <- delivery{ctx.Context().Err(), ctx.Context().Value(eventTestKey{})}
+		return nil
+	}})
+
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), eventTestKey{}, "publisher"))
+	meta := NewMeta().WithContext(parent)
+	events.Publish(meta, "event.async.created", Map{"id": 1})
+	cancel()
+	close(release)
+
+	select {
+	case out := <-delivered:
+		if out.err != nil {
+			t.Fatalf("async delivery context error = %v, want none", out.err)
+		}
+		if out.value != "publisher" {
+			t.Fatalf("async delivery context value = %v, want publisher", out.value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async subscriber not delivered")
+	}
+}
@@ -0,0 +1,72 @@
+package bamgoo
+
+import (
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+type (
+	// Future is the pending result of an asynchronous invocation.
+	Future struct {
+		done chan struct{}
+		data Map
+		res  Res
+	}
+)
+
+func newFuture(meta *Meta, name string, value Map, settings ...Map) *Future {
+	future := &Future{done: make(chan struct{})}
+	child := meta.child()
+	go func() {
+		defer close(future.done)
+		future.data, future.res = core.Invoke(child, name, value, settings...)
+		meta.adopt(child)
+	}()
+	return future
+}
+
+// Done is closed when the invocation finishes.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the invocation finishes.
+func (f *Future) Wait() (Map, Res) {
+	<-f.done
+	return f.data, f.res
+}
+
+// WaitTimeout waits at most timeout, returns false with Timeout when not finished.
+// The invocation keeps running, it can be waited again.
+func (f *Future) WaitTimeout(timeout time.Duration) (Map, Res, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-f.done:
+		return f.data, f.res, true
+	case <-timer.C:
+		return nil, Timeout, false
+	}
+}
+
+// InvokeAsync calls another service without blocking,
+// maps after the value are used as invoke settings.
+func (m *Meta) InvokeAsync(name string, values ...Map) *Future {
+	var value Map
+	var settings []Map
+	if len(values) > 0 {
+		value = values[0]
+		settings = values[1:]
+	}
+	return newFuture(m, name, value, settings...)
+}
+
+// InvokeAsync calls a method/service without blocking.
+func InvokeAsync(meta *Meta, name string, value Map, settings ...Map) *Future {
+	if meta == nil {
+		meta = NewMeta()
+	}
+	return newFuture(meta, name, value, settings...)
+}
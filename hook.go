@@ -9,8 +9,9 @@ import (
 )
 
 var (
-	errBusHookMissing    = errors.New("bus hook not registered")
-	errConfigHookMissing = errors.New("config hook not registered")
+	errBusHookMissing      = errors.New("bus hook not registered")
+	errConfigHookMissing   = errors.New("config hook not registered")
+	errRegistryHookMissing = errors.New("registry hook not registered")
 )
 
 // Hook exposes hook registrations and access (main -> sub).
@@ -20,8 +21,12 @@ type (
 	bamgooHook struct {
 		mutex sync.RWMutex
 
-		bus    BusHook
-		config ConfigHook
+		bus      BusHook
+		config   ConfigHook
+		panic    PanicHook
+		cache    CacheHook
+		trace    TraceHook
+		registry RegistryHook
 	}
 
 	BusHook interface {
@@ -34,6 +39,30 @@ type (
 	ConfigHook interface {
 		LoadConfig() (base.Map, error)
 	}
+
+	// PanicHook receives panics recovered from invocations.
+	PanicHook interface {
+		ReportPanic(meta *Meta, name string, value base.Any, stack []byte)
+	}
+
+	// CacheHook stores cached invocation results.
+	CacheHook interface {
+		LoadCache(key string) (CacheItem, bool)
+		StoreCache(key string, item CacheItem, ttl time.Duration)
+		DeleteCache(key string)
+	}
+
+	// TraceHook exports finished spans.
+	TraceHook interface {
+		ExportSpan(span Span)
+	}
+
+	// RegistryHook stores nodes announced by discovery.
+	RegistryHook interface {
+		Announce(node Node, ttl time.Duration) error
+		Withdraw(node Node) error
+		Nodes() ([]Node, error)
+	}
 )
 
 // Attach dispatches Module.Attach based on type.
@@ -43,6 +72,14 @@ func (h *bamgooHook) Attach(value base.Any) {
 		h.AttachBus(v)
 	case ConfigHook:
 		h.AttachConfig(v)
+	case PanicHook:
+		h.AttachPanic(v)
+	case CacheHook:
+		h.AttachCache(v)
+	case TraceHook:
+		h.AttachTrace(v)
+	case RegistryHook:
+		h.AttachRegistry(v)
 	}
 }
 
@@ -68,6 +105,50 @@ func (h *bamgooHook) AttachConfig(hook ConfigHook) {
 	h.config = hook
 }
 
+func (h *bamgooHook) AttachPanic(hook PanicHook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hook == nil {
+		panic("Invalid panic hook")
+	}
+
+	h.panic = hook
+}
+
+func (h *bamgooHook) AttachCache(hook CacheHook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hook == nil {
+		panic("Invalid cache hook")
+	}
+
+	h.cache = hook
+}
+
+func (h *bamgooHook) AttachTrace(hook TraceHook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hook == nil {
+		panic("Invalid trace hook")
+	}
+
+	h.trace = hook
+}
+
+func (h *bamgooHook) AttachRegistry(hook RegistryHook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if hook == nil {
+		panic("Invalid registry hook")
+	}
+
+	h.registry = hook
+}
+
 func (h *bamgooHook) LoadConfig() (base.Map, error) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
@@ -88,22 +169,22 @@ func (h *bamgooHook) Request(meta *Meta, name string, value base.Map, timeout ti
 	return h.bus.Request(meta, name, value, timeout)
 }
 
-func (h *bamgooHook) Publish(name string, value base.Map) error {
+func (h *bamgooHook) Publish(meta *Meta, name string, value base.Map) error {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 	if h.bus == nil {
 		return errBusHookMissing
 	}
-	return h.bus.Publish(nil, name, value)
+	return h.bus.Publish(meta, name, value)
 }
 
-func (h *bamgooHook) Enqueue(name string, value base.Map) error {
+func (h *bamgooHook) Enqueue(meta *Meta, name string, value base.Map) error {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 	if h.bus == nil {
 		return errBusHookMissing
 	}
-	return h.bus.Enqueue(nil, name, value)
+	return h.bus.Enqueue(meta, name, value)
 }
 
 func (h *bamgooHook) Stats() []ServiceStats {
@@ -114,3 +195,78 @@ func (h *bamgooHook) Stats() []ServiceStats {
 	}
 	return h.bus.Stats()
 }
+
+// ReportPanic reports a recovered panic (main -> sub).
+func (h *bamgooHook) ReportPanic(meta *Meta, name string, value base.Any, stack []byte) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.panic == nil {
+		return
+	}
+	h.panic.ReportPanic(meta, name, value, stack)
+}
+
+func (h *bamgooHook) LoadCache(key string) (CacheItem, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.cache == nil {
+		return CacheItem{}, false
+	}
+	return h.cache.LoadCache(key)
+}
+
+func (h *bamgooHook) StoreCache(key string, item CacheItem, ttl time.Duration) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.cache == nil {
+		return
+	}
+	h.cache.StoreCache(key, item, ttl)
+}
+
+func (h *bamgooHook) DeleteCache(key string) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.cache == nil {
+		return
+	}
+	h.cache.DeleteCache(key)
+}
+
+// ExportSpan exports a finished span (main -> sub).
+func (h *bamgooHook) ExportSpan(span Span) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.trace == nil {
+		return
+	}
+	h.trace.ExportSpan(span)
+}
+
+// Announce stores a node in the registry until ttl passes.
+func (h *bamgooHook) Announce(node Node, ttl time.Duration) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.registry == nil {
+		return errRegistryHookMissing
+	}
+	return h.registry.Announce(node, ttl)
+}
+
+func (h *bamgooHook) Withdraw(node Node) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.registry == nil {
+		return errRegistryHookMissing
+	}
+	return h.registry.Withdraw(node)
+}
+
+func (h *bamgooHook) Nodes() ([]Node, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.registry == nil {
+		return nil, errRegistryHookMissing
+	}
+	return h.registry.Nodes()
+}
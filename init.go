@@ -1,12 +1,25 @@
 package bamgoo
 
 func init() {
+	Mount(logger)
 	Mount(core)
 	Mount(basic)
 	Mount(library)
 	Mount(trigger)
+	Mount(events)
 	Mount(providers)
+	Mount(breaker)
+	Mount(limiter)
+	Mount(cacher)
+	Mount(queues)
+	Mount(network)
+	Mount(discovery)
+	Mount(metrics)
+	Mount(tracer)
 
 	hook.AttachBus(&defaultBusHook{})
 	hook.AttachConfig(&defaultConfigHook{})
+	hook.AttachPanic(&defaultPanicHook{})
+	hook.AttachCache(newMemoryCache(defaultCacheSize))
+	hook.AttachRegistry(newMemoryRegistry())
 }
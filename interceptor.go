@@ -0,0 +1,111 @@
+package bamgoo
+
+import (
+	. "github.com/bamgoo/base"
+)
+
+type (
+	// InvokeFunc is the next step of an invocation chain.
+	InvokeFunc func(*Context) (Map, Res)
+
+	// Interceptor wraps invocations of methods, services and library methods.
+	// Match is a name pattern, empty matches every name.
+	// Example:
+	// Register("auth", Interceptor{
+	//   Match: "user.*",
+	//   Action: func(ctx *Context, next InvokeFunc) (Map, Res) {
+	//     if ctx.Unauthed() {
+	//       return nil, Unauthed
+	//     }
+	//     return next(ctx)
+	//   },
+	// })
+	Interceptor struct {
+		Name   string
+		Desc   string
+		Match  string
+		Action func(*Context, InvokeFunc) (Map, Res)
+	}
+)
+
+// RegisterInterceptor registers an interceptor, interceptors run in registration order.
+func (e *coreModule) RegisterInterceptor(name string, interceptor Interceptor) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if name == "" {
+		return
+	}
+	if interceptor.Action == nil {
+		panic("invalid interceptor: " + name)
+	}
+	if interceptor.Name == "" {
+		interceptor.Name = name
+	}
+
+	for i, item := range e.interceptors {
+		if item.Name != interceptor.Name {
+			continue
+		}
+		if !Override() {
+			panic("interceptor already registered: " + name)
+		}
+		e.interceptors[i] = interceptor
+		return
+	}
+	e.interceptors = append(e.interceptors, interceptor)
+}
+
+// intercept wraps action with all interceptors matching ctx.Name.
+func (e *coreModule) intercept(ctx *Context, action InvokeFunc) (Map, Res) {
+	e.mutex.RLock()
+	chain := make([]Interceptor, 0, len(e.interceptors))
+	for _, item := range e.interceptors {
+		if item.Match == "" || matchName(item.Match, ctx.Name) {
+			chain = append(chain, item)
+		}
+	}
+	e.mutex.RUnlock()
+
+	next := action
+	for i := len(chain) - 1; i >= 0; i-- {
+		call, inner := chain[i].Action, next
+		next = func(ctx *Context) (Map, Res) {
+			return call(ctx, inner)
+		}
+	}
+	return next(ctx)
+}
+
+// matchName reports whether name matches pattern.
+// "*" matches any sequence of characters, "?" matches a single character.
+func matchName(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	px, nx := 0, 0
+	star, mark := -1, 0
+	for nx < len(name) {
+		if px < len(pattern) && (pattern[px] == '?' || pattern[px] == name[nx]) {
+			px++
+			nx++
+			continue
+		}
+		if px < len(pattern) && pattern[px] == '*' {
+			star, mark = px, nx
+			px++
+			continue
+		}
+		if star >= 0 {
+			px = star + 1
+			mark++
+			nx = mark
+			continue
+		}
+		return false
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
+}
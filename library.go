@@ -70,7 +70,7 @@ func (m *libraryModule) RegisterLibrary(prefix string, def Library) {
 		}
 
 		full := joinLibraryName(prefix, key)
-		core.RegisterMethod(full, method)
+		core.registerMethod(full, method, prefix)
 	}
 }
 
@@ -151,6 +151,23 @@ func (m *libraryModule) Load(name string) (Library, bool) {
 	return lib, ok
 }
 
+// Libraries returns all registered libraries keyed by prefix.
+func (m *libraryModule) Libraries() map[string]Library {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	libs := make(map[string]Library, len(m.libraries))
+	for k, v := range m.libraries {
+		libs[k] = v
+	}
+	return libs
+}
+
+// Libraries returns all registered libraries keyed by prefix.
+func Libraries() map[string]Library {
+	return library.Libraries()
+}
+
 func normalizeLibraryName(name string) string {
 	name = strings.TrimSpace(strings.ToLower(name))
 	name = strings.TrimPrefix(name, ".")
@@ -0,0 +1,319 @@
+package bamgoo
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const limitSweepInterval = time.Minute
+
+var limiter = &limitModule{
+	configs:   make(map[string]Map, 0),
+	buckets:   make(map[string]*tokenBucket, 0),
+	bulkheads: make(map[string]*bulkhead, 0),
+}
+
+type (
+	// limitModule enforces token-bucket rate limits and concurrency bulkheads.
+	// Limits come from Setting["limit"] of the entry or the call, or config by name pattern:
+	// [limit."report.*"]
+	// rate = 10          # requests per second
+	// burst = 20         # bucket size, defaults to rate
+	// concurrency = 5    # max in-flight invocations
+	// wait = "500ms"     # how long an over-limit call may queue
+	// key = "token"      # split limits by meta: token, tokenid, language, trace
+	limitModule struct {
+		mutex     sync.Mutex
+		configs   map[string]Map
+		buckets   map[string]*tokenBucket
+		bulkheads map[string]*bulkhead
+		sweeped   time.Time
+	}
+
+	limitPolicy struct {
+		Rate        float64
+		Burst       int
+		Concurrency int
+		Wait        time.Duration
+		Key         string
+	}
+
+	tokenBucket struct {
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+
+	// bulkhead counts in-flight invocations of a key, guarded by the module mutex.
+	// It is kept while users hold or wait for a slot, a changed limit applies in place.
+	bulkhead struct {
+		limit    int
+		inflight int
+		users    int
+		wake     chan struct{}
+	}
+)
+
+func (m *limitModule) Register(string, Any) {}
+
+// Config loads limits keyed by name pattern.
+func (m *limitModule) Config(global Map) {
+	cfg, ok := global["limit"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for pattern, value := range cfg {
+		if vv, ok := value.(Map); ok {
+			m.configs[pattern] = vv
+		}
+	}
+}
+
+func (m *limitModule) Setup() {}
+func (m *limitModule) Open()  {}
+func (m *limitModule) Start() {}
+func (m *limitModule) Stop()  {}
+func (m *limitModule) Close() {}
+
+// policy resolves limits for ctx, call and entry setting override config,
+// longer config patterns override shorter ones.
+func (m *limitModule) policy(ctx *Context) (limitPolicy, bool) {
+	m.mutex.Lock()
+	patterns := make([]string, 0)
+	for pattern := range m.configs {
+		if pattern == ctx.Name || matchName(pattern, ctx.Name) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) < len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	configs := make([]Map, 0, len(patterns)+1)
+	for _, pattern := range patterns {
+		configs = append(configs, m.configs[pattern])
+	}
+	m.mutex.Unlock()
+
+	if cfg, ok := ctx.Setting["limit"].(Map); ok {
+		configs = append(configs, cfg)
+	}
+	if len(configs) == 0 {
+		return limitPolicy{}, false
+	}
+
+	policy := limitPolicy{}
+	for _, cfg := range configs {
+		switch vv := cfg["rate"].(type) {
+		case int:
+			policy.Rate = float64(vv)
+		case int64:
+			policy.Rate = float64(vv)
+		case float64:
+			policy.Rate = vv
+		}
+		switch vv := cfg["burst"].(type) {
+		case int:
+			policy.Burst = vv
+		case int64:
+			policy.Burst = int(vv)
+		}
+		switch vv := cfg["concurrency"].(type) {
+		case int:
+			policy.Concurrency = vv
+		case int64:
+			policy.Concurrency = int(vv)
+		}
+		if vv, ok := parseDuration(cfg["wait"]); ok {
+			policy.Wait = vv
+		}
+		if vv, ok := cfg["key"].(string); ok {
+			policy.Key = vv
+		}
+	}
+	if policy.Burst <= 0 {
+		policy.Burst = max(int(policy.Rate), 1)
+	}
+	return policy, policy.Rate > 0 || policy.Concurrency > 0
+}
+
+// limitKey splits limits by caller attribute from meta.
+func limitKey(ctx *Context, key string) string {
+	switch strings.ToLower(key) {
+	case "token":
+		return ctx.Token()
+	case "tokenid", "id":
+		return ctx.TokenId()
+	case "language", "lang":
+		return ctx.Language()
+	case "trace", "traceid":
+		return ctx.TraceId()
+	}
+	return ""
+}
+
+// Acquire takes a rate token and a concurrency slot for ctx, waiting up to
+// the wait budget. The returned release must be called when the action finishes.
+func (m *limitModule) Acquire(ctx *Context) (func(), Res) {
+	policy, ok := m.policy(ctx)
+	if !ok {
+		return func() {}, nil
+	}
+
+	key := ctx.Name + "|" + limitKey(ctx, policy.Key)
+	deadline := time.Now().Add(policy.Wait)
+	done := ctx.Context().Done()
+
+	if policy.Rate > 0 {
+		delay, ok := m.reserve(key, policy, time.Now())
+		if !ok {
+			return nil, Limited
+		}
+		if delay > 0 && !sleepContext(ctx.Context(), delay) {
+			return nil, Limited
+		}
+	}
+
+	if policy.Concurrency <= 0 {
+		return func() {}, nil
+	}
+
+	slots := m.bulkhead(key, policy.Concurrency)
+	var timer *time.Timer
+	for {
+		m.mutex.Lock()
+		if slots.inflight < slots.limit {
+			slots.inflight++
+			m.mutex.Unlock()
+			break
+		}
+		wake := slots.wake
+		m.mutex.Unlock()
+
+		if timer == nil {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				m.leave(slots, false)
+				return nil, Limited
+			}
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			m.leave(slots, false)
+			return nil, Limited
+		case <-done:
+			m.leave(slots, false)
+			return nil, Limited
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { m.leave(slots, true) })
+	}, nil
+}
+
+// reserve takes a token from the bucket of key, returns how long to wait for it.
+// Fails when the wait exceeds the policy budget, no token is taken then.
+func (m *limitModule) reserve(key string, policy limitPolicy, now time.Time) (time.Duration, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sweep(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok || bucket.rate != policy.Rate || bucket.burst != float64(policy.Burst) {
+		bucket = &tokenBucket{
+			rate: policy.Rate, burst: float64(policy.Burst),
+			tokens: float64(policy.Burst), last: now,
+		}
+		m.buckets[key] = bucket
+	}
+
+	bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	delay := time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+	if delay > policy.Wait {
+		return 0, false
+	}
+	bucket.tokens--
+	return delay, true
+}
+
+// bulkhead returns the bulkhead of key and counts the caller as its user.
+func (m *limitModule) bulkhead(key string, concurrency int) *bulkhead {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	slots, ok := m.bulkheads[key]
+	if !ok {
+		slots = &bulkhead{wake: make(chan struct{})}
+		m.bulkheads[key] = slots
+	}
+	slots.limit = concurrency
+	slots.users++
+	return slots
+}
+
+// leave ends a user of the bulkhead, releasing its slot when held.
+func (m *limitModule) leave(slots *bulkhead, held bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	slots.users--
+	if held {
+		slots.inflight--
+		close(slots.wake)
+		slots.wake = make(chan struct{})
+	}
+}
+
+// sweep drops full idle buckets and unused bulkheads, so per-caller keys do not pile up.
+func (m *limitModule) sweep(now time.Time) {
+	if now.Sub(m.sweeped) < limitSweepInterval {
+		return
+	}
+	m.sweeped = now
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.last) >= limitSweepInterval {
+			delete(m.buckets, key)
+		}
+	}
+	for key, slots := range m.bulkheads {
+		if slots.users == 0 {
+			delete(m.bulkheads, key)
+		}
+	}
+}
+
+// sleepContext sleeps for d, returns false when ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,433 @@
+package bamgoo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/bamgoo/base"
+)
+
+// LevelOff disables logging of a package or method.
+const LevelOff = slog.Level(100)
+
+var logger = &logModule{
+	config: logConfig{Level: slog.LevelInfo, Format: "text", Console: true},
+	sinks:  []slog.Handler{newFormatSink(os.Stderr, "text")},
+	extras: make(map[string]slog.Handler, 0),
+}
+
+type (
+	// logModule fans log records out to sinks, levels are per package or method.
+	// Config example:
+	// [log]
+	// level = "info"
+	// format = "text"            # console format, text or json
+	// console = true             # false disables the console sink
+	// default = false            # true makes it the slog default logger
+	// [log.levels]
+	// core = "debug"             # package name, method name or pattern like "user.*"
+	// [log.file]
+	// path = "logs/bamgoo.log"   # json lines, rotated by size
+	// format = "json"
+	// size = 100                 # megabytes before rotating
+	// backups = 5
+	//
+	// More sinks are registered as slog.Handler: bamgoo.Register("audit", handler).
+	logModule struct {
+		mutex      sync.RWMutex
+		config     logConfig
+		sinks      []slog.Handler
+		generation uint64 // bumped by rebuild, so loggers know their sinks are stale
+		extras     map[string]slog.Handler
+		file       *rotateWriter
+	}
+	logConfig struct {
+		Level   slog.Level
+		Levels  map[string]slog.Level
+		Format  string
+		Console bool
+		Default bool
+		File    string // format of the file sink
+	}
+
+	// logHandler is the slog.Handler behind every bamgoo logger, name selects the level.
+	// The sinks wrapped by chain are kept until the module rebuilds its sinks.
+	logHandler struct {
+		name  string
+		chain []func(slog.Handler) slog.Handler
+
+		mutex      sync.Mutex
+		sinks      []slog.Handler
+		generation uint64
+	}
+
+	// rotateWriter is a file that rotates to name.1 ... name.N when it grows beyond size.
+	rotateWriter struct {
+		mutex   sync.Mutex
+		path    string
+		size    int64
+		backups int
+		file    *os.File
+		written int64
+	}
+)
+
+// Register adds a named slog.Handler as extra sink.
+func (m *logModule) Register(name string, value Any) {
+	handler, ok := value.(slog.Handler)
+	if !ok {
+		return
+	}
+	if name == "" {
+		name = fmt.Sprintf("sink%d", len(m.extras))
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.extras[name]; ok && !bamgoo.Override() {
+		panic("Log sink already registered: " + name)
+	}
+	m.extras[name] = handler
+	m.rebuild()
+}
+
+// Config loads levels and rebuilds the built-in sinks.
+func (m *logModule) Config(global Map) {
+	cfg, ok := global["log"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if level, ok := parseLevel(cfg["level"]); ok {
+		m.config.Level = level
+	}
+	if levels, ok := cfg["levels"].(Map); ok {
+		m.config.Levels = make(map[string]slog.Level, len(levels))
+		for name, value := range levels {
+			if level, ok := parseLevel(value); ok {
+				m.config.Levels[name] = level
+			}
+		}
+	}
+	if vv, ok := cfg["format"].(string); ok && vv != "" {
+		m.config.Format = vv
+	}
+	if vv, ok := cfg["console"].(bool); ok {
+		m.config.Console = vv
+	}
+	if vv, ok := cfg["default"].(bool); ok {
+		m.config.Default = vv
+	}
+
+	if vv, ok := cfg["file"].(Map); ok {
+		path, _ := vv["path"].(string)
+		if path == "" {
+			path = "logs/bamgoo.log"
+		}
+		size, _ := parseInt(vv["size"])
+		backups, _ := parseInt(vv["backups"])
+		m.config.File = "json"
+		if format, ok := vv["format"].(string); ok && format != "" {
+			m.config.File = format
+		}
+
+		file, err := newRotateWriter(path, int64(size)<<20, backups)
+		if err != nil {
+			panic(fmt.Errorf("open log file failed: %w", err))
+		}
+		m.closeFile()
+		m.file = file
+	}
+	m.rebuild()
+
+	if m.config.Default {
+		slog.SetDefault(slog.New(&logHandler{}))
+	}
+}
+
+// rebuild recreates sinks from config.
+func (m *logModule) rebuild() {
+	sinks := make([]slog.Handler, 0, 2+len(m.extras))
+	if m.config.Console {
+		sinks = append(sinks, newFormatSink(os.Stderr, m.config.Format))
+	}
+	if m.file != nil {
+		sinks = append(sinks, newFormatSink(m.file, m.config.File))
+	}
+
+	names := make([]string, 0, len(m.extras))
+	for name := range m.extras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sinks = append(sinks, m.extras[name])
+	}
+	m.sinks = sinks
+	m.generation++
+}
+
+func (m *logModule) Setup() {}
+func (m *logModule) Open()  {}
+func (m *logModule) Start() {}
+func (m *logModule) Stop()  {}
+
+// Close closes log files.
+func (m *logModule) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closeFile()
+	m.rebuild()
+}
+
+func (m *logModule) closeFile() {
+	if m.file != nil {
+		_ = m.file.Close()
+		m.file = nil
+	}
+}
+
+// level returns the level of a package or method, exact names win over patterns,
+// longer patterns win over shorter ones.
+func (m *logModule) level(name string) slog.Level {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if name == "" || len(m.config.Levels) == 0 {
+		return m.config.Level
+	}
+	if level, ok := m.config.Levels[name]; ok {
+		return level
+	}
+	best, level := -1, m.config.Level
+	for pattern, lvl := range m.config.Levels {
+		if len(pattern) > best && matchName(pattern, name) {
+			best, level = len(pattern), lvl
+		}
+	}
+	return level
+}
+
+// Logger returns a logger of a package or method.
+func (m *logModule) Logger(name string) *slog.Logger {
+	handler := &logHandler{name: name}
+	if name != "" {
+		return slog.New(handler).With("logger", name)
+	}
+	return slog.New(handler)
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logger.level(h.name)
+}
+
+func (h *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	var failed error
+	for _, sink := range h.wrapped() {
+		if !sink.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := sink.Handle(ctx, record.Clone()); err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// wrapped returns the sinks of the module with attrs and groups of h applied,
+// they are wrapped again only after the module rebuilt its sinks.
+func (h *logHandler) wrapped() []slog.Handler {
+	logger.mutex.RLock()
+	sinks, generation := logger.sinks, logger.generation
+	logger.mutex.RUnlock()
+
+	if len(h.chain) == 0 {
+		return sinks
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.sinks != nil && h.generation == generation {
+		return h.sinks
+	}
+	wrapped := make([]slog.Handler, 0, len(sinks))
+	for _, sink := range sinks {
+		for _, wrap := range h.chain {
+			sink = wrap(sink)
+		}
+		wrapped = append(wrapped, sink)
+	}
+	h.sinks, h.generation = wrapped, generation
+	return wrapped
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(sink slog.Handler) slog.Handler { return sink.WithAttrs(attrs) })
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(sink slog.Handler) slog.Handler { return sink.WithGroup(name) })
+}
+
+func (h *logHandler) with(wrap func(slog.Handler) slog.Handler) *logHandler {
+	chain := make([]func(slog.Handler) slog.Handler, len(h.chain), len(h.chain)+1)
+	copy(chain, h.chain)
+	return &logHandler{name: h.name, chain: append(chain, wrap)}
+}
+
+// newFormatSink accepts every level, filtering is done by logHandler.
+func newFormatSink(writer io.Writer, format string) slog.Handler {
+	options := &slog.HandlerOptions{Level: slog.Level(-100)}
+	if strings.ToLower(format) == "json" {
+		return slog.NewJSONHandler(writer, options)
+	}
+	return slog.NewTextHandler(writer, options)
+}
+
+func newRotateWriter(path string, size int64, backups int) (*rotateWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w := &rotateWriter{path: path, size: size, backups: backups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file, w.written = file, info.Size()
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.size > 0 && w.written > 0 && w.written+int64(len(p)) > w.size {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// rotate shifts name.N-1 to name.N ... name to name.1, dropping the oldest.
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.backups > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", w.path, w.backups))
+		for i := w.backups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		_ = os.Rename(w.path, w.path+".1")
+	} else {
+		_ = os.Remove(w.path)
+	}
+	return w.open()
+}
+
+func (w *rotateWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// parseLevel converts "debug", "info", "warn", "error" or "off" into slog.Level.
+func parseLevel(value Any) (slog.Level, bool) {
+	str, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	switch strings.ToLower(str) {
+	case "off", "none":
+		return LevelOff, true
+	case "warning":
+		return slog.LevelWarn, true
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(str)); err != nil {
+		return 0, false
+	}
+	return level, true
+}
+
+// logAttrs returns attrs of meta for loggers.
+func (m *Meta) logAttrs() []Any {
+	m.mutex.RLock()
+	traceId, spanId, language := m.traceId, m.spanId, m.language
+	m.mutex.RUnlock()
+
+	bamgoo.mutex.RLock()
+	node := bamgoo.node
+	bamgoo.mutex.RUnlock()
+
+	attrs := make([]Any, 0, 8)
+	if traceId != "" {
+		attrs = append(attrs, "trace", traceId)
+	}
+	if spanId != "" {
+		attrs = append(attrs, "span", spanId)
+	}
+	if language != "" {
+		attrs = append(attrs, "language", language)
+	}
+	if node != "" {
+		attrs = append(attrs, "node", node)
+	}
+	return attrs
+}
+
+// Logger returns a logger carrying trace, span, language and node of meta.
+func (m *Meta) Logger() *slog.Logger {
+	return logger.Logger("").With(m.logAttrs()...)
+}
+
+// Logger returns a logger of the invoked method, its level follows the method name.
+func (ctx *Context) Logger() *slog.Logger {
+	return slog.New(&logHandler{name: ctx.Name}).With(append(ctx.logAttrs(), "method", ctx.Name)...)
+}
+
+// Logger returns the logger of a package, levels of [log.levels] apply by name.
+func Logger(name string) *slog.Logger {
+	return logger.Logger(name)
+}
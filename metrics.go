@@ -0,0 +1,271 @@
+package bamgoo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var metrics = &metricsModule{
+	config: metricsConfig{
+		Path: "/metrics",
+	},
+	triggers:  make(map[string]int64, 0),
+	providers: make(map[[2]string]int64, 0),
+}
+
+type (
+	// metricsModule renders runtime metrics in Prometheus text format.
+	// Config example:
+	// [metrics]
+	// listen = "127.0.0.1:9100"   # serve over http when set
+	// path = "/metrics"
+	metricsModule struct {
+		mutex  sync.Mutex
+		config metricsConfig
+		server *http.Server
+
+		triggers  map[string]int64
+		providers map[[2]string]int64
+		ids       atomic.Int64
+	}
+	metricsConfig struct {
+		Listen string
+		Path   string
+	}
+)
+
+func (m *metricsModule) Register(string, Any) {}
+
+// Config loads metrics config.
+func (m *metricsModule) Config(global Map) {
+	cfg, ok := global["metrics"].(Map)
+	if !ok {
+		return
+	}
+	if vv, ok := cfg["listen"].(string); ok {
+		m.config.Listen = vv
+	}
+	if vv, ok := cfg["path"].(string); ok && vv != "" {
+		m.config.Path = vv
+	}
+}
+
+func (m *metricsModule) Setup() {}
+func (m *metricsModule) Open()  {}
+
+// Start serves metrics over http when listen is configured.
+func (m *metricsModule) Start() {
+	if m.config.Listen == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", m.config.Listen)
+	if err != nil {
+		panic(fmt.Errorf("metrics listen failed: %w", err))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(m.config.Path, m.Handler())
+
+	m.mutex.Lock()
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	server := m.server
+	m.mutex.Unlock()
+
+	go server.Serve(listener)
+}
+
+func (m *metricsModule) Stop() {
+	m.mutex.Lock()
+	server := m.server
+	m.server = nil
+	m.mutex.Unlock()
+
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
+func (m *metricsModule) Close() {}
+
+// trigger counts a trigger run.
+func (m *metricsModule) trigger(name string) {
+	m.mutex.Lock()
+	m.triggers[name]++
+	m.mutex.Unlock()
+}
+
+// provider counts a provider build, ok is false when the build failed.
+func (m *metricsModule) provider(name string, ok bool) {
+	result := "ok"
+	if !ok {
+		result = "error"
+	}
+	m.mutex.Lock()
+	m.providers[[2]string{name, result}]++
+	m.mutex.Unlock()
+}
+
+// Handler serves metrics for scraping.
+func (m *metricsModule) Handler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", metricsContentType)
+		_ = m.Write(res)
+	})
+}
+
+// Write renders all metrics in Prometheus text format.
+func (m *metricsModule) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+
+	bamgoo.mutex.RLock()
+	base := metricLabels{
+		{"name", bamgoo.name}, {"role", bamgoo.role},
+		{"node", bamgoo.node}, {"version", bamgoo.version},
+	}
+	bamgoo.mutex.RUnlock()
+
+	counters := statistics.snapshot()
+
+	metricHead(w, "bamgoo_invocations_total", "counter", "Invocations made through core.")
+	for _, c := range counters {
+		metricLine(w, "bamgoo_invocations_total", base.with("service", c.name, "service_version", c.version), float64(c.requests))
+	}
+	metricHead(w, "bamgoo_invocation_errors_total", "counter", "Invocations that returned a failed result.")
+	for _, c := range counters {
+		metricLine(w, "bamgoo_invocation_errors_total", base.with("service", c.name, "service_version", c.version), float64(c.errors))
+	}
+	metricHead(w, "bamgoo_invocation_duration_seconds", "histogram", "Invocation latency.")
+	for _, c := range counters {
+		labels := base.with("service", c.name, "service_version", c.version)
+		total := 0
+		for i, count := range c.buckets {
+			total += count
+			le := "+Inf"
+			if i < len(statsBuckets) {
+				le = strconv.FormatFloat(statsBuckets[i]/1000, 'g', -1, 64)
+			}
+			metricLine(w, "bamgoo_invocation_duration_seconds_bucket", labels.with("le", le), float64(total))
+		}
+		metricLine(w, "bamgoo_invocation_duration_seconds_sum", labels, c.latency.Seconds())
+		metricLine(w, "bamgoo_invocation_duration_seconds_count", labels, float64(c.requests))
+	}
+
+	queueStats := queues.Stats()
+	metricHead(w, "bamgoo_queue_depth", "gauge", "Messages waiting in local queues.")
+	for _, q := range queueStats {
+		metricLine(w, "bamgoo_queue_depth", base.with("queue", q.Name), float64(q.Depth))
+	}
+	metricHead(w, "bamgoo_queue_inflight", "gauge", "Messages being processed by local queues.")
+	for _, q := range queueStats {
+		metricLine(w, "bamgoo_queue_inflight", base.with("queue", q.Name), float64(q.Inflight))
+	}
+	metricHead(w, "bamgoo_queue_dead", "gauge", "Dead letters kept by local queues.")
+	for _, q := range queueStats {
+		metricLine(w, "bamgoo_queue_dead", base.with("queue", q.Name), float64(q.Dead))
+	}
+	queueCounters := []struct {
+		name, help string
+		value      func(QueueStats) int64
+	}{
+		{"bamgoo_queue_enqueued_total", "Messages accepted by local queues.", func(q QueueStats) int64 { return q.Enqueued }},
+		{"bamgoo_queue_processed_total", "Messages processed successfully by local queues.", func(q QueueStats) int64 { return q.Processed }},
+		{"bamgoo_queue_failed_total", "Failed deliveries of local queues.", func(q QueueStats) int64 { return q.Failed }},
+		{"bamgoo_queue_retried_total", "Redeliveries scheduled by local queues.", func(q QueueStats) int64 { return q.Retried }},
+		{"bamgoo_queue_rejected_total", "Messages rejected by full local queues.", func(q QueueStats) int64 { return q.Rejected }},
+	}
+	for _, counter := range queueCounters {
+		metricHead(w, counter.name, "counter", counter.help)
+		for _, q := range queueStats {
+			metricLine(w, counter.name, base.with("queue", q.Name), float64(counter.value(q)))
+		}
+	}
+
+	m.mutex.Lock()
+	triggers := make([]string, 0, len(m.triggers))
+	for name := range m.triggers {
+		triggers = append(triggers, name)
+	}
+	sort.Strings(triggers)
+	metricHead(w, "bamgoo_trigger_runs_total", "counter", "Trigger runs.")
+	for _, name := range triggers {
+		metricLine(w, "bamgoo_trigger_runs_total", base.with("trigger", name), float64(m.triggers[name]))
+	}
+
+	builds := make([][2]string, 0, len(m.providers))
+	for key := range m.providers {
+		builds = append(builds, key)
+	}
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i][0]+"|"+builds[i][1] < builds[j][0]+"|"+builds[j][1]
+	})
+	metricHead(w, "bamgoo_provider_builds_total", "counter", "Provider builds.")
+	for _, key := range builds {
+		metricLine(w, "bamgoo_provider_builds_total", base.with("provider", key[0], "result", key[1]), float64(m.providers[key]))
+	}
+	m.mutex.Unlock()
+
+	metricHead(w, "bamgoo_ids_generated_total", "counter", "Sequence ids generated.")
+	metricLine(w, "bamgoo_ids_generated_total", base, float64(m.ids.Load()))
+
+	return w.Flush()
+}
+
+type (
+	metricLabels []metricLabel
+	metricLabel  struct {
+		name  string
+		value string
+	}
+)
+
+// with returns a copy of labels with extra name/value pairs.
+func (labels metricLabels) with(pairs ...string) metricLabels {
+	out := make(metricLabels, len(labels), len(labels)+len(pairs)/2)
+	copy(out, labels)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out = append(out, metricLabel{pairs[i], pairs[i+1]})
+	}
+	return out
+}
+
+func (labels metricLabels) String() string {
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		value := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(label.value)
+		parts = append(parts, label.name+`="`+value+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func metricHead(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func metricLine(w io.Writer, name string, labels metricLabels, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// WriteMetrics renders runtime metrics in Prometheus text format.
+func WriteMetrics(writer io.Writer) error {
+	return metrics.Write(writer)
+}
+
+// MetricsHandler returns an http handler serving runtime metrics.
+func MetricsHandler() http.Handler {
+	return metrics.Handler()
+}
@@ -0,0 +1,722 @@
+package bamgoo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	HTTP = "http"
+	TCP  = "tcp"
+
+	REQUEST = "request"
+
+	networkPath     = "/_bamgoo"
+	networkMaxFrame = 64 << 20
+)
+
+const (
+	headerKind     = "X-Bamgoo-Kind"
+	headerName     = "X-Bamgoo-Name"
+	headerTimeout  = "X-Bamgoo-Timeout"
+	headerTrace    = "X-Bamgoo-Trace"
+	headerSpan     = "X-Bamgoo-Span"
+	headerParent   = "X-Bamgoo-Parent"
+	headerLanguage = "X-Bamgoo-Language"
+	headerTimezone = "X-Bamgoo-Timezone"
+	headerToken    = "X-Bamgoo-Token"
+)
+
+var (
+	network = &networkModule{
+		config: networkConfig{Codec: JSON, Routes: make(map[string][]string, 0)},
+		conns:  make(map[string]*tcpClient, 0),
+		next:   make(map[string]*atomic.Uint64, 0),
+	}
+
+	errNoRoute        = errors.New("no route to service")
+	errNetworkClosed  = errors.New("network connection closed")
+	errNetworkFrame   = errors.New("invalid network frame")
+	errServiceMissing = errors.New("service not found")
+)
+
+type (
+	// networkModule connects bamgoo processes, Service entries are served to other
+	// nodes and calls without a local entry are sent to the node of their route,
+	// or to a node found by discovery.
+	// Config example:
+	// [bus]
+	// driver = "http"                # http or tcp, empty keeps the local bus
+	// listen = "127.0.0.1:7001"
+	// codec = "json"                 # codec of payloads
+	// peers = ["127.0.0.1:7002"]     # publish targets, default all route addresses
+	// [bus.routes]
+	// "user.*" = ["127.0.0.1:7002"]  # name or pattern to node addresses
+	networkModule struct {
+		mutex  sync.Mutex
+		config networkConfig
+		bus    *networkBus
+
+		server   *http.Server
+		listener net.Listener
+		client   *http.Client
+		conns    map[string]*tcpClient
+		next     map[string]*atomic.Uint64
+	}
+	networkConfig struct {
+		Driver string
+		Listen string
+		Codec  string
+		Peers  []string
+		Routes map[string][]string
+	}
+
+	// networkBus is the BusHook attached when a network driver is configured.
+	networkBus struct {
+		module *networkModule
+	}
+
+	// tcpClient multiplexes calls over one connection, replies match calls by id.
+	tcpClient struct {
+		mutex   sync.Mutex
+		address string
+		codec   string
+		conn    net.Conn
+		seq     uint64
+		pending map[uint64]chan Map
+	}
+)
+
+func (m *networkModule) Register(string, Any) {}
+
+// Config loads bus config and attaches the network bus when a driver is set.
+func (m *networkModule) Config(global Map) {
+	cfg, ok := global["bus"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if vv, ok := cfg["driver"].(string); ok {
+		m.config.Driver = vv
+	}
+	if vv, ok := cfg["listen"].(string); ok {
+		m.config.Listen = vv
+	}
+	if vv, ok := cfg["codec"].(string); ok && vv != "" {
+		m.config.Codec = vv
+	}
+	if vv, ok := cfg["peers"]; ok {
+		m.config.Peers = parseStrings(vv)
+	}
+	if routes, ok := cfg["routes"].(Map); ok {
+		for name, value := range routes {
+			m.config.Routes[name] = parseStrings(value)
+		}
+	}
+
+	switch m.config.Driver {
+	case HTTP, TCP:
+		if m.bus == nil {
+			m.bus = &networkBus{m}
+		}
+		hook.AttachBus(m.bus)
+	case "", DEFAULT:
+	default:
+		panic("Unknown bus driver: " + m.config.Driver)
+	}
+}
+
+func (m *networkModule) Setup() {}
+
+// Open listens for other nodes.
+func (m *networkModule) Open() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.bus == nil || m.config.Listen == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", m.config.Listen)
+	if err != nil {
+		panic(fmt.Errorf("bus listen failed: %w", err))
+	}
+	m.listener = listener
+
+	if m.config.Driver == HTTP {
+		mux := http.NewServeMux()
+		mux.Handle(networkPath, http.HandlerFunc(m.serveHTTP))
+		m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go m.server.Serve(listener)
+		return
+	}
+	go m.serveTCP(listener)
+}
+
+func (m *networkModule) Start() {}
+func (m *networkModule) Stop()  {}
+
+// Close stops serving and closes connections to other nodes.
+func (m *networkModule) Close() {
+	m.mutex.Lock()
+	server, listener := m.server, m.listener
+	m.server, m.listener = nil, nil
+	conns := m.conns
+	m.conns = make(map[string]*tcpClient, 0)
+	m.mutex.Unlock()
+
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	} else if listener != nil {
+		_ = listener.Close()
+	}
+	for _, conn := range conns {
+		conn.close()
+	}
+}
+
+// route returns the address of the node serving name, static routes rotate over
+// their addresses, otherwise the balancer of discovery picks a node.
+func (m *networkModule) route(name string, value Map) (string, bool) {
+	if address, ok := m.static(name); ok {
+		return address, true
+	}
+	return discovery.route(name, value)
+}
+
+// static returns the next address of the longest route matching name.
+func (m *networkModule) static(name string) (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	best, addresses := -1, []string(nil)
+	for pattern, list := range m.config.Routes {
+		if len(list) > 0 && len(pattern) > best && (pattern == name || matchName(pattern, name)) {
+			best, addresses = len(pattern), list
+		}
+	}
+	if len(addresses) == 0 {
+		return "", false
+	}
+	counter, ok := m.next[name]
+	if !ok {
+		counter = &atomic.Uint64{}
+		m.next[name] = counter
+	}
+	return addresses[(counter.Add(1)-1)%uint64(len(addresses))], true
+}
+
+// peers returns the publish targets.
+func (m *networkModule) peers() []string {
+	m.mutex.Lock()
+	if len(m.config.Peers) > 0 {
+		peers := append([]string{}, m.config.Peers...)
+		m.mutex.Unlock()
+		return peers
+	}
+	seen := map[string]bool{m.config.Listen: true}
+	peers := make([]string, 0)
+	for _, list := range m.config.Routes {
+		for _, address := range list {
+			if !seen[address] {
+				seen[address] = true
+				peers = append(peers, address)
+			}
+		}
+	}
+	m.mutex.Unlock()
+
+	seen[discovery.address()] = true
+	for _, node := range discovery.Nodes() {
+		if node.Address != "" && !seen[node.Address] {
+			seen[node.Address] = true
+			peers = append(peers, node.Address)
+		}
+	}
+	return peers
+}
+
+// send delivers a call to the node at address and waits for the reply.
+func (m *networkModule) send(address, kind string, meta *Meta, name string, value Map, timeout time.Duration) (Map, error) {
+	ctx := context.Background()
+	if meta != nil {
+		ctx = meta.Context()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	m.mutex.Lock()
+	driver, codecName := m.config.Driver, m.config.Codec
+	m.mutex.Unlock()
+
+	metadata := Metadata{}
+	if meta != nil {
+		metadata = meta.Metadata()
+	}
+	if value == nil {
+		value = Map{}
+	}
+	done := discovery.begin(address)
+	defer done()
+	if driver == HTTP {
+		return m.sendHTTP(ctx, address, codecName, kind, metadata, name, value, timeout)
+	}
+	return m.tcp(address, codecName).call(ctx, Map{
+		"kind": kind, "name": name, "value": value,
+		"metadata": metadataMap(metadata), "timeout": timeout.Milliseconds(),
+	})
+}
+
+func (m *networkModule) sendHTTP(ctx context.Context, address, codecName, kind string, metadata Metadata, name string, value Map, timeout time.Duration) (Map, error) {
+	body, err := codec.Marshal(codecName, value)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+networkPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/"+codecName)
+	req.Header.Set(headerKind, kind)
+	req.Header.Set(headerName, name)
+	if timeout > 0 {
+		req.Header.Set(headerTimeout, strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
+	setHeader := func(key, value string) {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	setHeader(headerTrace, metadata.TraceId)
+	setHeader(headerSpan, metadata.SpanId)
+	setHeader(headerParent, metadata.ParentId)
+	setHeader(headerLanguage, metadata.Language)
+	setHeader(headerToken, metadata.Token)
+	if metadata.Timezone != 0 {
+		req.Header.Set(headerTimezone, strconv.Itoa(metadata.Timezone))
+	}
+
+	m.mutex.Lock()
+	if m.client == nil {
+		m.client = &http.Client{}
+	}
+	client := m.client
+	m.mutex.Unlock()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, networkMaxFrame))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bus http status %d: %s", res.StatusCode, bytes.TrimSpace(data))
+	}
+	reply := Map{}
+	if err := codec.Unmarshal(codecName, data, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (m *networkModule) serveHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mutex.Lock()
+	codecName := m.config.Codec
+	m.mutex.Unlock()
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, networkMaxFrame))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	value := Map{}
+	if len(body) > 0 {
+		if err := codec.Unmarshal(codecName, body, &value); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metadata := Metadata{
+		TraceId: req.Header.Get(headerTrace), SpanId: req.Header.Get(headerSpan),
+		ParentId: req.Header.Get(headerParent), Language: req.Header.Get(headerLanguage),
+		Token: req.Header.Get(headerToken),
+	}
+	metadata.Timezone, _ = strconv.Atoi(req.Header.Get(headerTimezone))
+	timeout := time.Duration(0)
+	if ms, err := strconv.ParseInt(req.Header.Get(headerTimeout), 10, 64); err == nil {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	reply := m.handle(req.Context(), req.Header.Get(headerKind), req.Header.Get(headerName), value, metadata, timeout)
+	data, err := codec.Marshal(codecName, reply)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/"+codecName)
+	_, _ = res.Write(data)
+}
+
+// handle serves a call of another node, only Service entries can be requested.
+func (m *networkModule) handle(parent context.Context, kind, name string, value Map, metadata Metadata, timeout time.Duration) Map {
+	meta := NewMeta()
+	meta.Metadata(metadata)
+	defer meta.close()
+
+	ctx := parent
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
+	}
+	meta.WithContext(ctx)
+
+	switch kind {
+	case REQUEST:
+		entry, _, ok := core.resolve(name)
+		if !ok || !entry.remote {
+			return replyMap(nil, errorResult(fmt.Errorf("%w: %s", errServiceMissing, name)))
+		}
+		data, res, _ := core.invokeLocal(meta, name, value)
+		return replyMap(data, res)
+	case PUBLISH:
+		// methods are never reached from other nodes, not even by the deprecated fallback
+		events.publish(meta, name, value, false)
+		return replyMap(nil, nil)
+	case ENQUEUE:
+		entry, _, ok := core.resolve(name)
+		if !ok || !entry.remote {
+			return replyMap(nil, errorResult(fmt.Errorf("%w: %s", errServiceMissing, name)))
+		}
+		if err := queues.Enqueue(meta, name, value); err != nil {
+			return replyMap(nil, errorResult(err))
+		}
+		return replyMap(nil, nil)
+	}
+	return replyMap(nil, errorResult(fmt.Errorf("unknown bus call: %s", kind)))
+}
+
+func (m *networkModule) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go m.serveConn(conn)
+	}
+}
+
+// serveConn reads calls from conn and writes replies as they finish.
+func (m *networkModule) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	m.mutex.Lock()
+	codecName := m.config.Codec
+	m.mutex.Unlock()
+
+	var wmutex sync.Mutex
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader, codecName)
+		if err != nil {
+			return
+		}
+		go func(frame Map) {
+			value, _ := frame["value"].(Map)
+			metadata, _ := frame["metadata"].(Map)
+			name, _ := frame["name"].(string)
+			kind, _ := frame["kind"].(string)
+			ms, _ := parseInt(frame["timeout"])
+
+			reply := m.handle(ctx, kind, name, value, parseMetadata(metadata), time.Duration(ms)*time.Millisecond)
+			reply["id"] = frame["id"]
+
+			wmutex.Lock()
+			defer wmutex.Unlock()
+			_ = writeFrame(conn, codecName, reply)
+		}(frame)
+	}
+}
+
+// tcp returns the connection pool of address.
+func (m *networkModule) tcp(address, codecName string) *tcpClient {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	client, ok := m.conns[address]
+	if !ok {
+		client = &tcpClient{address: address, codec: codecName, pending: make(map[uint64]chan Map, 0)}
+		m.conns[address] = client
+	}
+	return client
+}
+
+// call sends frame and waits for its reply, connecting when needed.
+func (c *tcpClient) call(ctx context.Context, frame Map) (Map, error) {
+	c.mutex.Lock()
+	if c.conn == nil {
+		dialer := net.Dialer{}
+		conn, err := dialer.DialContext(ctx, "tcp", c.address)
+		if err != nil {
+			c.mutex.Unlock()
+			return nil, err
+		}
+		c.conn = conn
+		go c.read(conn)
+	}
+	c.seq++
+	id := c.seq
+	reply := make(chan Map, 1)
+	c.pending[id] = reply
+	frame["id"] = int64(id)
+	err := writeFrame(c.conn, c.codec, frame)
+	c.mutex.Unlock()
+
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	select {
+	case data, ok := <-reply:
+		if !ok {
+			return nil, errNetworkClosed
+		}
+		return data, nil
+	case <-ctx.Done():
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// read dispatches replies until conn fails.
+func (c *tcpClient) read(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader, c.codec)
+		if err != nil {
+			c.drop(conn)
+			return
+		}
+		id, _ := parseInt(frame["id"])
+		c.mutex.Lock()
+		reply, ok := c.pending[uint64(id)]
+		delete(c.pending, uint64(id))
+		c.mutex.Unlock()
+		if ok {
+			reply <- frame
+		}
+	}
+}
+
+// drop forgets conn and fails its pending calls, a later call reconnects.
+func (c *tcpClient) drop(conn net.Conn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn != conn {
+		return
+	}
+	_ = conn.Close()
+	c.conn = nil
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+}
+
+func (c *tcpClient) close() {
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+	if conn != nil {
+		c.drop(conn)
+	}
+}
+
+func writeFrame(writer io.Writer, codecName string, frame Map) error {
+	data, err := codec.Marshal(codecName, frame)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = writer.Write(buf)
+	return err
+}
+
+func readFrame(reader io.Reader, codecName string) (Map, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length == 0 || length > networkMaxFrame {
+		return nil, errNetworkFrame
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	frame := Map{}
+	if err := codec.Unmarshal(codecName, data, &frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// replyMap encodes an invocation outcome.
+func replyMap(data Map, res Res) Map {
+	reply := Map{"data": data}
+	if res != nil {
+		reply["code"], reply["state"], reply["args"] = res.Code(), res.State(), res.Args()
+	}
+	return reply
+}
+
+// replyResult decodes an invocation outcome.
+func replyResult(reply Map) (Map, Res) {
+	data, _ := reply["data"].(Map)
+	code, _ := parseInt(reply["code"])
+	state, _ := reply["state"].(string)
+	args, _ := reply["args"].([]Any)
+	if code == 0 && state == "" {
+		return data, nil
+	}
+	if args == nil {
+		args = []Any{}
+	}
+	return data, &result{code, state, args, false}
+}
+
+func metadataMap(metadata Metadata) Map {
+	return Map{
+		"tid": metadata.TraceId, "sid": metadata.SpanId, "pid": metadata.ParentId,
+		"l": metadata.Language, "z": metadata.Timezone, "t": metadata.Token,
+	}
+}
+
+func parseMetadata(data Map) Metadata {
+	metadata := Metadata{}
+	metadata.TraceId, _ = data["tid"].(string)
+	metadata.SpanId, _ = data["sid"].(string)
+	metadata.ParentId, _ = data["pid"].(string)
+	metadata.Language, _ = data["l"].(string)
+	metadata.Token, _ = data["t"].(string)
+	metadata.Timezone, _ = parseInt(data["z"])
+	return metadata
+}
+
+// parseStrings converts a string or list of strings.
+func parseStrings(value Any) []string {
+	switch vv := value.(type) {
+	case string:
+		return []string{vv}
+	case []string:
+		return vv
+	case []Any:
+		list := make([]string, 0, len(vv))
+		for _, item := range vv {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Request calls the node serving name.
+func (b *networkBus) Request(meta *Meta, name string, value Map, timeout time.Duration) (Map, Res) {
+	address, ok := b.module.route(name, value)
+	if !ok {
+		return nil, errorResult(fmt.Errorf("%w: %s", errNoRoute, name))
+	}
+	reply, err := b.module.send(address, REQUEST, meta, name, value, timeout)
+	if err != nil {
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return nil, Timeout
+		}
+		return nil, contextResult(err)
+	}
+	return replyResult(reply)
+}
+
+// Publish delivers to local subscribers and to every peer.
+func (b *networkBus) Publish(meta *Meta, name string, value Map) error {
+	events.Publish(meta, name, value)
+
+	var wg sync.WaitGroup
+	for _, address := range b.module.peers() {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			if _, err := b.module.send(address, PUBLISH, meta, name, value, core.config.Timeout); err != nil {
+				logger.Logger("bus").Warn("publish to peer failed", "peer", address, "event", name, "error", err.Error())
+			}
+		}(address)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Enqueue sends to the queue of the node serving name, or the local queue.
+func (b *networkBus) Enqueue(meta *Meta, name string, value Map) error {
+	if entry, _, ok := core.resolve(name); ok && entry.Action != nil {
+		return queues.Enqueue(meta, name, value)
+	}
+	address, ok := b.module.route(name, value)
+	if !ok {
+		return queues.Enqueue(meta, name, value)
+	}
+	reply, err := b.module.send(address, ENQUEUE, meta, name, value, core.config.Timeout)
+	if err != nil {
+		return err
+	}
+	if _, res := replyResult(reply); res != nil && res.Fail() {
+		return errors.New(res.State())
+	}
+	return nil
+}
+
+func (b *networkBus) Stats() []ServiceStats {
+	return nil
+}
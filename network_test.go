@@ -0,0 +1,267 @@
+package bamgoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+var (
+	networkTestOnce    sync.Once
+	networkTestEntered = make(map[string]*networkTestEntries, 0)
+)
+
+// networkTestEntries receive the language of delivered events and messages.
+type networkTestEntries struct {
+	events chan string
+	mails  chan string
+}
+
+func TestNetworkHTTP(t *testing.T) {
+	testNetwork(t, HTTP)
+}
+
+func TestNetworkTCP(t *testing.T) {
+	server, client, prefix, _ := testNetwork(t, TCP)
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				data, res := client.bus.Request(NewMeta(), prefix+".echo", Map{"id": i}, time.Second)
+				if res != nil && res.Fail() {
+					errs <- fmt.Errorf("request %d failed: %s", i, res.State())
+					return
+				}
+				if got := fmt.Sprint(data["id"]); got != fmt.Sprint(i) {
+					errs <- fmt.Errorf("request %d got reply of %s", i, got)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		failed := make(chan error, 1)
+		go func() {
+			_, err := client.send(server.config.Listen, REQUEST, NewMeta(), prefix+".slow", nil, 5*time.Second)
+			failed <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		client.tcp(server.config.Listen, JSON).close()
+
+		select {
+		case err := <-failed:
+			if !errors.Is(err, errNetworkClosed) {
+				t.Fatalf("pending call error = %v, want %v", err, errNetworkClosed)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("pending call not failed when its connection dropped")
+		}
+
+		// a later call connects again
+		if _, res := client.bus.Request(NewMeta(), prefix+".echo", Map{"id": 1}, time.Second); res != nil && res.Fail() {
+			t.Fatalf("request after drop failed: %s", res.State())
+		}
+	})
+
+	t.Run("frame", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.config.Listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], networkMaxFrame+1)
+		if _, err := conn.Write(header[:]); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("read after oversized frame = %v, want connection closed", err)
+		}
+	})
+}
+
+// testNetwork runs a server and a client node of driver on 127.0.0.1 and
+// checks request, publish and enqueue between them.
+func testNetwork(t *testing.T, driver string) (*networkModule, *networkModule, string, *networkTestEntries) {
+	networkTestOnce.Do(func() {
+		events.Setup()
+		queues.Open()
+	})
+
+	prefix := "net." + driver
+	entries := registerNetworkEntries(prefix)
+	server := newTestNetwork(t, driver, nil)
+	client := newTestNetwork(t, driver, map[string][]string{prefix + ".*": {server.config.Listen}})
+
+	t.Run("request", func(t *testing.T) {
+		meta := NewMeta()
+		meta.TraceId("trace-" + driver)
+		meta.Language("en-US")
+		meta.Token("token-" + driver)
+		meta.Timezone(time.FixedZone("", 8*3600))
+
+		data, res := client.bus.Request(meta, prefix+".echo", Map{"id": 7}, time.Second)
+		if res != nil && res.Fail() {
+			t.Fatalf("request failed: %s", res.State())
+		}
+		want := Map{
+			"id": "7", "trace": "trace-" + driver, "language": "en-US",
+			"token": "token-" + driver, "timezone": "28800",
+		}
+		for key, value := range want {
+			if got := fmt.Sprint(data[key]); got != value {
+				t.Errorf("%s = %s, want %s", key, got, value)
+			}
+		}
+	})
+
+	t.Run("result", func(t *testing.T) {
+		_, res := client.bus.Request(NewMeta(), prefix+".invalid", nil, time.Second)
+		if res == nil || res.Code() != Invalid.Code() {
+			t.Fatalf("result = %v, want %v", res, Invalid)
+		}
+	})
+
+	t.Run("method", func(t *testing.T) {
+		_, res := client.bus.Request(NewMeta(), prefix+".local", nil, time.Second)
+		if res == nil || res.OK() {
+			t.Fatal("method served to another node")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, res := client.bus.Request(NewMeta(), prefix+".slow", nil, 50*time.Millisecond)
+		if res == nil || res.Code() != Timeout.Code() {
+			t.Fatalf("result = %v, want %v", res, Timeout)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		_, res := client.bus.Request(NewMeta(), "net.none.echo", nil, time.Second)
+		if res == nil || res.OK() {
+			t.Fatal("request without route succeeded")
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		meta := NewMeta()
+		meta.Language("de")
+		if err := client.bus.Publish(meta, prefix+".created", Map{"id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		// one delivery on the client node itself, one through the peer
+		for i := 0; i < 2; i++ {
+			select {
+			case language := <-entries.events:
+				if language != "de" {
+					t.Fatalf("event language = %s, want de", language)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("got %d event deliveries, want 2", i)
+			}
+		}
+	})
+
+	t.Run("enqueue", func(t *testing.T) {
+		meta := NewMeta()
+		meta.Language("fr")
+		reply, err := client.send(server.config.Listen, ENQUEUE, meta, prefix+".mail", Map{"to": "a"}, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, res := replyResult(reply); res != nil && res.Fail() {
+			t.Fatalf("enqueue failed: %s", res.State())
+		}
+		select {
+		case language := <-entries.mails:
+			if language != "fr" {
+				t.Fatalf("message language = %s, want fr", language)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("enqueued message not processed")
+		}
+
+		reply, err = client.send(server.config.Listen, ENQUEUE, NewMeta(), prefix+".local", nil, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, res := replyResult(reply); res == nil || res.OK() {
+			t.Fatal("method enqueued by another node")
+		}
+	})
+
+	return server, client, prefix, entries
+}
+
+// newTestNetwork starts a node of driver on a free port of 127.0.0.1.
+func newTestNetwork(t *testing.T, driver string, routes map[string][]string) *networkModule {
+	t.Helper()
+	if routes == nil {
+		routes = make(map[string][]string, 0)
+	}
+	m := &networkModule{
+		config: networkConfig{Driver: driver, Listen: "127.0.0.1:0", Codec: JSON, Routes: routes},
+		conns:  make(map[string]*tcpClient, 0),
+		next:   make(map[string]*atomic.Uint64, 0),
+	}
+	m.bus = &networkBus{m}
+	m.Open()
+	m.config.Listen = m.listener.Addr().String()
+	t.Cleanup(m.Close)
+	return m
+}
+
+// registerNetworkEntries registers the entries of prefix once, so tests can run repeatedly.
+func registerNetworkEntries(prefix string) *networkTestEntries {
+	if entries, ok := networkTestEntered[prefix]; ok {
+		return entries
+	}
+	entries := &networkTestEntries{events: make(chan string, 10), mails: make(chan string, 10)}
+	networkTestEntered[prefix] = entries
+
+	core.RegisterService(prefix+".echo", Service{Action: func(ctx *Context) (Map, Res) {
+		_, offset := time.Now().In(ctx.Timezone()).Zone()
+		return Map{
+			"id": ctx.Value["id"], "trace": ctx.TraceId(), "language": ctx.Language(),
+			"token": ctx.Token(), "timezone": offset,
+		}, nil
+	}})
+	core.RegisterService(prefix+".invalid", Service{Action: func(ctx *Context) (Map, Res) {
+		return nil, Invalid
+	}})
+	core.RegisterService(prefix+".slow", Service{Action: func(ctx *Context) (Map, Res) {
+		time.Sleep(300 * time.Millisecond)
+		return nil, nil
+	}})
+	core.RegisterMethod(prefix+".local", Method{Action: func(ctx *Context) (Map, Res) {
+		return Map{}, nil
+	}})
+	core.RegisterService(prefix+".mail", Service{Action: func(ctx *Context) (Map, Res) {
+		entries.mails <- ctx.Language()
+		return nil, nil
+	}})
+	events.RegisterSubscriber(prefix+".created", Subscriber{Action: func(ctx *Context) Res {
+		entries.events <- ctx.Language()
+		return nil
+	}})
+	return entries
+}
@@ -3,6 +3,7 @@ package bamgoo
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 
 	. "github.com/bamgoo/base"
@@ -61,6 +62,7 @@ func (m *providerModule) Use(name string, setting Map) (Any, error) {
 	}
 
 	impl, err := provider.UseProvider(setting)
+	metrics.provider(name, err == nil && impl != nil)
 	if err != nil {
 		return nil, fmt.Errorf("build provider failed: %s: %w", name, err)
 	}
@@ -71,6 +73,19 @@ func (m *providerModule) Use(name string, setting Map) (Any, error) {
 	return impl, nil
 }
 
+// Providers returns names of all registered providers.
+func (m *providerModule) Providers() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, 0, len(m.providers))
+	for name := range m.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (m *providerModule) Config(Map) {}
 func (m *providerModule) Setup()     {}
 func (m *providerModule) Open()      {}
@@ -95,3 +110,8 @@ func Use[T any](name string, setting Map) (T, error) {
 
 	return typed, nil
 }
+
+// Providers returns names of all registered providers.
+func Providers() []string {
+	return providers.Providers()
+}
@@ -0,0 +1,878 @@
+package bamgoo
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	BLOCK  = "block"
+	REJECT = "reject"
+	MEMORY = "memory"
+	WAL    = "wal"
+
+	defaultQueueDrain = 10 * time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("queue is full")
+	ErrQueueClosed = errors.New("queue is closed")
+)
+
+var queues = &queueModule{
+	config:  defaultQueueConfig(),
+	configs: make(map[string]queueConfig, 0),
+	queues:  make(map[string]*localQueue, 0),
+	drain:   defaultQueueDrain,
+}
+
+type (
+	// Message is an enqueued invocation.
+	Message struct {
+		Id       string    `json:"id"`
+		Queue    string    `json:"queue"`
+		Name     string    `json:"name"`
+		Value    Map       `json:"value,omitempty"`
+		Metadata Metadata  `json:"metadata"`
+		Attempt  int       `json:"attempt"`
+		Enqueued time.Time `json:"enqueued"`
+		Due      time.Time `json:"due,omitempty"`
+		Code     int       `json:"code,omitempty"`
+		State    string    `json:"state,omitempty"`
+	}
+
+	// QueueStats contains queue statistics.
+	QueueStats struct {
+		Name      string `json:"name"`
+		Workers   int    `json:"workers"`
+		Capacity  int    `json:"capacity"`
+		Depth     int    `json:"depth"`
+		Inflight  int64  `json:"inflight"`
+		Delayed   int    `json:"delayed"`
+		Dead      int    `json:"dead"`
+		Enqueued  int64  `json:"enqueued"`
+		Processed int64  `json:"processed"`
+		Failed    int64  `json:"failed"`
+		Retried   int64  `json:"retried"`
+		Rejected  int64  `json:"rejected"`
+	}
+
+	// queueModule runs local queues behind Enqueue of the default bus.
+	// Config example, top level values are defaults of every queue:
+	// [queue]
+	// workers = 10
+	// buffer = 1000
+	// policy = "block"       # block or reject when the buffer is full
+	// attempts = 1           # deliveries of a message failing with a retryable result
+	// delay = "1s"           # first redelivery delay, doubled per attempt
+	// max = "1m"             # max redelivery delay
+	// dead = 1000            # dead letters kept per queue
+	// drain = "10s"          # how long Stop waits for queued messages
+	// driver = "memory"      # memory, or wal to keep messages on disk until processed
+	// dir = "data/queue"     # wal directory, each queue uses a sub directory
+	// fsync = "always"       # always, interval or never
+	// interval = "1s"        # fsync interval
+	// segment = 64           # megabytes of a wal segment
+	// [queue.mail]
+	// workers = 2
+	// names = ["mail.*"]     # message names of the queue, default the queue name and "name.*"
+	// [queue.billing]
+	// driver = "wal"
+	//
+	// Entries pick a queue with Setting{"queue": "mail"} as well.
+	queueModule struct {
+		mutex   sync.Mutex
+		config  queueConfig
+		configs map[string]queueConfig
+		queues  map[string]*localQueue
+		drain   time.Duration
+		opened  bool
+		closed  bool
+	}
+	queueConfig struct {
+		Workers  int
+		Buffer   int
+		Policy   string
+		Attempts int
+		Delay    time.Duration
+		MaxDelay time.Duration
+		Dead     int
+		Names    []string
+
+		Driver   string
+		Dir      string
+		Fsync    string
+		Interval time.Duration
+		Segment  int64
+	}
+
+	localQueue struct {
+		mutex   sync.Mutex
+		name    string
+		config  queueConfig
+		buffer  chan *Message
+		quit    chan struct{}
+		workers sync.WaitGroup
+		started bool
+		closed  atomic.Bool
+
+		// store keeps messages of wal queues, recovered is pushed at start
+		store     *walStore
+		recovered []Message
+
+		// scheduled holds messages due later, cancelled ones stay in the heap
+		// until they come up and are skipped
+		scheduled map[string]*Message
+		timeline  messageHeap
+		wake      chan struct{}
+		dead      []Message
+
+		inflight  atomic.Int64
+		enqueued  atomic.Int64
+		processed atomic.Int64
+		failed    atomic.Int64
+		retried   atomic.Int64
+		rejected  atomic.Int64
+	}
+
+	// messageHeap orders messages by due time.
+	messageHeap []*Message
+)
+
+func defaultQueueConfig() queueConfig {
+	return queueConfig{
+		Workers: 10, Buffer: 1000, Policy: BLOCK,
+		Attempts: 1, Delay: time.Second, MaxDelay: time.Minute, Dead: 1000,
+		Driver: MEMORY, Dir: "data/queue", Fsync: ALWAYS,
+		Interval: defaultWalFsync, Segment: defaultWalSize,
+	}
+}
+
+// parseQueueConfig overlays cfg onto config.
+func parseQueueConfig(config queueConfig, cfg Map) queueConfig {
+	if vv, ok := parseInt(cfg["workers"]); ok && vv > 0 {
+		config.Workers = vv
+	}
+	if vv, ok := parseInt(cfg["buffer"]); ok && vv > 0 {
+		config.Buffer = vv
+	}
+	if vv, ok := cfg["policy"].(string); ok && (vv == BLOCK || vv == REJECT) {
+		config.Policy = vv
+	}
+	if vv, ok := parseInt(cfg["attempts"]); ok && vv > 0 {
+		config.Attempts = vv
+	}
+	if vv, ok := parseDuration(cfg["delay"]); ok {
+		config.Delay = vv
+	}
+	if vv, ok := parseDuration(cfg["max"]); ok {
+		config.MaxDelay = vv
+	}
+	if vv, ok := parseInt(cfg["dead"]); ok && vv >= 0 {
+		config.Dead = vv
+	}
+	if vv, ok := cfg["driver"].(string); ok && (vv == MEMORY || vv == WAL) {
+		config.Driver = vv
+	}
+	if vv, ok := cfg["dir"].(string); ok && vv != "" {
+		config.Dir = vv
+	}
+	if vv, ok := cfg["fsync"].(string); ok && (vv == ALWAYS || vv == INTERVAL || vv == NEVER) {
+		config.Fsync = vv
+	}
+	if vv, ok := parseDuration(cfg["interval"]); ok && vv > 0 {
+		config.Interval = vv
+	}
+	if vv, ok := parseInt(cfg["segment"]); ok && vv > 0 {
+		config.Segment = int64(vv) << 20
+	}
+	switch vv := cfg["names"].(type) {
+	case []string:
+		config.Names = vv
+	case []Any:
+		config.Names = nil
+		for _, name := range vv {
+			if str, ok := name.(string); ok {
+				config.Names = append(config.Names, str)
+			}
+		}
+	}
+	return config
+}
+
+func (m *queueModule) Register(string, Any) {}
+
+// Config loads default and named queue configs.
+func (m *queueModule) Config(global Map) {
+	cfg, ok := global["queue"].(Map)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config = parseQueueConfig(m.config, cfg)
+	if vv, ok := parseDuration(cfg["drain"]); ok {
+		m.drain = vv
+	}
+	for name, value := range cfg {
+		if vv, ok := value.(Map); ok {
+			base := m.config
+			base.Names = nil
+			m.configs[name] = parseQueueConfig(base, vv)
+		}
+	}
+}
+
+func (m *queueModule) Setup() {}
+
+// Open creates configured queues, starts workers and restores wal messages.
+func (m *queueModule) Open() {
+	m.mutex.Lock()
+	m.queue(DEFAULT)
+	for name := range m.configs {
+		m.queue(name)
+	}
+	list := make([]*localQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		list = append(list, q)
+	}
+	m.opened = true
+	m.mutex.Unlock()
+
+	for _, q := range list {
+		q.restore(q.start())
+	}
+}
+
+func (m *queueModule) Start() {}
+
+// Stop waits for queued messages until drain passes, then stops workers.
+func (m *queueModule) Stop() {
+	m.mutex.Lock()
+	m.closed = true
+	list := make([]*localQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		list = append(list, q)
+	}
+	drain := m.drain
+	m.mutex.Unlock()
+
+	deadline := time.Now().Add(drain)
+	var wg sync.WaitGroup
+	for _, q := range list {
+		wg.Add(1)
+		go func(q *localQueue) {
+			defer wg.Done()
+			q.stop(deadline)
+		}(q)
+	}
+	wg.Wait()
+}
+
+func (m *queueModule) Close() {}
+
+// queue returns the queue of name, creating it when missing, mutex must be held.
+func (m *queueModule) queue(name string) *localQueue {
+	if q, ok := m.queues[name]; ok {
+		return q
+	}
+	config, ok := m.configs[name]
+	if !ok {
+		config = m.config
+	}
+	q := &localQueue{
+		name: name, config: config,
+		buffer:    make(chan *Message, config.Buffer),
+		quit:      make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		scheduled: make(map[string]*Message, 0),
+	}
+	if m.closed {
+		q.closed.Store(true)
+	}
+	if config.Driver == WAL {
+		store, err := openWalStore(filepath.Join(config.Dir, name), config.Fsync, config.Interval, config.Segment)
+		if err != nil {
+			panic(fmt.Errorf("open queue %s failed: %w", name, err))
+		}
+		q.store = store
+		q.recovered, q.dead = store.Recovered()
+	}
+	m.queues[name] = q
+	if m.opened {
+		go q.restore(q.start())
+	}
+	return q
+}
+
+// route picks the queue of a message name: entry setting, configured names,
+// then a queue with the same name, otherwise the default queue.
+func (m *queueModule) route(name string) string {
+	if entry, _, ok := core.resolve(name); ok {
+		if vv, ok := entry.Setting["queue"].(string); ok && vv != "" {
+			return vv
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	best, queue := -1, ""
+	for key, config := range m.configs {
+		patterns := config.Names
+		if len(patterns) == 0 {
+			patterns = []string{key, key + ".*"}
+		}
+		for _, pattern := range patterns {
+			if len(pattern) > best && (pattern == name || matchName(pattern, name)) {
+				best, queue = len(pattern), key
+			}
+		}
+	}
+	if queue != "" {
+		return queue
+	}
+	if _, ok := m.queues[name]; ok {
+		return name
+	}
+	return DEFAULT
+}
+
+// find returns an existing queue.
+func (m *queueModule) find(name string) (*localQueue, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	q, ok := m.queues[name]
+	return q, ok
+}
+
+// message creates a message of name and returns it with its queue.
+func (m *queueModule) message(meta *Meta, name string, value Map) (*Message, *localQueue) {
+	msg := &Message{
+		Id: newTraceId(), Name: name, Value: value,
+		Queue: m.route(name), Enqueued: time.Now(),
+	}
+	if meta != nil {
+		msg.Metadata = meta.Metadata()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return msg, m.queue(msg.Queue)
+}
+
+// Enqueue puts an invocation into its queue.
+func (m *queueModule) Enqueue(meta *Meta, name string, value Map) error {
+	msg, q := m.message(meta, name, value)
+	ctx := context.Background()
+	if meta != nil {
+		ctx = meta.Context()
+	}
+
+	// a wal queue accepts the message only when it is written
+	if q.store != nil {
+		if err := q.store.Put(*msg); err != nil {
+			return err
+		}
+	}
+	if err := q.push(ctx, msg, q.config.Policy == BLOCK); err != nil {
+		if q.store != nil {
+			q.persisted(q.store.Ack(msg.Id))
+		}
+		return err
+	}
+	q.enqueued.Add(1)
+	return nil
+}
+
+// Schedule puts an invocation into its queue to run at due, returns the message id.
+func (m *queueModule) Schedule(meta *Meta, name string, value Map, due time.Time) (string, error) {
+	msg, q := m.message(meta, name, value)
+	msg.Due = due
+	if q.closed.Load() {
+		return "", ErrQueueClosed
+	}
+	if q.store != nil {
+		if err := q.store.Put(*msg); err != nil {
+			return "", err
+		}
+	}
+	q.schedule(msg)
+	q.enqueued.Add(1)
+	return msg.Id, nil
+}
+
+// Cancel removes a scheduled message that is not due yet.
+func (m *queueModule) Cancel(id string) bool {
+	m.mutex.Lock()
+	list := make([]*localQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		list = append(list, q)
+	}
+	m.mutex.Unlock()
+
+	for _, q := range list {
+		if q.cancel(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns statistics of all queues sorted by name.
+func (m *queueModule) Stats() []QueueStats {
+	m.mutex.Lock()
+	list := make([]*localQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		list = append(list, q)
+	}
+	m.mutex.Unlock()
+
+	stats := make([]QueueStats, 0, len(list))
+	for _, q := range list {
+		stats = append(stats, q.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// DeadLetters returns dead messages of a queue.
+func (m *queueModule) DeadLetters(name string) []Message {
+	q, ok := m.find(name)
+	if !ok {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]Message{}, q.dead...)
+}
+
+// Replay puts dead messages back into the queue with fresh attempts, all when no ids given.
+func (m *queueModule) Replay(name string, ids ...string) (int, error) {
+	q, ok := m.find(name)
+	if !ok {
+		return 0, nil
+	}
+	count := 0
+	for _, msg := range q.take(ids...) {
+		msg.Attempt, msg.Code, msg.State = 0, 0, ""
+		if q.store != nil {
+			if err := q.store.Put(msg); err != nil {
+				q.bury(msg)
+				return count, err
+			}
+		}
+		if err := q.push(context.Background(), &msg, true); err != nil {
+			q.bury(msg)
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Purge drops dead messages of a queue, all when no ids given.
+func (m *queueModule) Purge(name string, ids ...string) int {
+	q, ok := m.find(name)
+	if !ok {
+		return 0
+	}
+	taken := q.take(ids...)
+	if q.store != nil {
+		for _, msg := range taken {
+			q.persisted(q.store.Ack(msg.Id))
+		}
+	}
+	return len(taken)
+}
+
+// start runs workers and returns messages recovered from wal.
+func (q *localQueue) start() []Message {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.started {
+		return nil
+	}
+	q.started = true
+	for i := 0; i < q.config.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	q.workers.Add(1)
+	go q.scheduling()
+
+	recovered := q.recovered
+	q.recovered = nil
+	return recovered
+}
+
+// restore pushes recovered messages in enqueue order, messages due later are scheduled.
+func (q *localQueue) restore(recovered []Message) {
+	now := time.Now()
+	for i := range recovered {
+		msg := &recovered[i]
+		if msg.Due.After(now) {
+			q.schedule(msg)
+			continue
+		}
+		if err := q.push(context.Background(), msg, true); err != nil {
+			break
+		}
+	}
+	if len(recovered) > 0 {
+		logger.Logger("queue").Info("queue recovered messages", "queue", q.name, "count", len(recovered))
+	}
+}
+
+// stop refuses new messages, waits for queued ones and those due before deadline,
+// then stops workers. Messages left are dropped, wal queues keep them for the next start.
+func (q *localQueue) stop(deadline time.Time) {
+	q.closed.Store(true)
+	for time.Now().Before(deadline) && !q.idle(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	q.mutex.Lock()
+	dropped := len(q.buffer) + len(q.scheduled)
+	q.mutex.Unlock()
+
+	close(q.quit)
+	q.workers.Wait()
+
+	if q.store != nil {
+		q.persisted(q.store.Close())
+		return
+	}
+	if dropped > 0 {
+		logger.Logger("queue").Warn("queue stopped with undelivered messages", "queue", q.name, "dropped", dropped)
+	}
+}
+
+func (q *localQueue) idle(deadline time.Time) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.buffer) > 0 || q.inflight.Load() > 0 {
+		return false
+	}
+	for _, msg := range q.scheduled {
+		if msg.Due.Before(deadline) {
+			return false
+		}
+	}
+	return true
+}
+
+// push adds msg into buffer, waiting for room when block, otherwise rejecting.
+func (q *localQueue) push(ctx context.Context, msg *Message, block bool) error {
+	if q.closed.Load() {
+		return ErrQueueClosed
+	}
+	if !block {
+		select {
+		case q.buffer <- msg:
+			return nil
+		default:
+			q.rejected.Add(1)
+			return ErrQueueFull
+		}
+	}
+	select {
+	case q.buffer <- msg:
+		return nil
+	case <-q.quit:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		q.rejected.Add(1)
+		return ctx.Err()
+	}
+}
+
+func (q *localQueue) work() {
+	defer q.workers.Done()
+	for {
+		select {
+		case msg := <-q.buffer:
+			q.process(msg)
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+// process invokes msg, redelivers failures the retry policy of the entry
+// accepts with backoff until attempts run out, then moves msg to dead letters.
+// Each delivery already retries in place by the same policy.
+func (q *localQueue) process(msg *Message) {
+	q.inflight.Add(1)
+	defer q.inflight.Add(-1)
+
+	msg.Attempt++
+	if msg.Attempt == 1 && !msg.Due.IsZero() && q.forward(msg) {
+		return
+	}
+	meta := NewMeta()
+	meta.Metadata(msg.Metadata)
+	_, res, ok := core.invokeLocal(meta, msg.Name, msg.Value)
+	meta.close()
+	if !ok {
+		res = Unavailable
+	}
+	if res == nil || res.OK() {
+		q.processed.Add(1)
+		if q.store != nil {
+			q.persisted(q.store.Ack(msg.Id))
+		}
+		return
+	}
+
+	q.failed.Add(1)
+	msg.Code, msg.State = res.Code(), res.State()
+	if msg.Attempt >= q.config.Attempts || !retryPolicyOf(msg.Name).retryable(res) {
+		q.bury(*msg)
+		return
+	}
+
+	q.retried.Add(1)
+	policy := retryPolicy{Delay: q.config.Delay, MaxDelay: q.config.MaxDelay, Jitter: defaultRetryJitter}
+	msg.Due = time.Now().Add(policy.backoff(msg.Attempt))
+	if q.store != nil {
+		q.persisted(q.store.Put(*msg))
+	}
+	q.schedule(msg)
+}
+
+// forward hands a due scheduled message without local entry to the bus,
+// as Enqueue does, so it reaches the node serving it.
+func (q *localQueue) forward(msg *Message) bool {
+	if entry, _, ok := core.resolve(msg.Name); ok && entry.Action != nil {
+		return false
+	}
+	meta := NewMeta()
+	meta.Metadata(msg.Metadata)
+	defer meta.close()
+	if err := hook.Enqueue(meta, msg.Name, msg.Value); err != nil {
+		logger.Logger("queue").Warn("forward scheduled message failed", "queue", q.name, "id", msg.Id, "name", msg.Name, "error", err.Error())
+		return false
+	}
+	q.processed.Add(1)
+	if q.store != nil {
+		q.persisted(q.store.Ack(msg.Id))
+	}
+	return true
+}
+
+// schedule keeps msg until its due time.
+func (q *localQueue) schedule(msg *Message) {
+	q.mutex.Lock()
+	q.scheduled[msg.Id] = msg
+	heap.Push(&q.timeline, msg)
+	first := q.timeline[0] == msg
+	q.mutex.Unlock()
+
+	if first {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// cancel removes a scheduled message.
+func (q *localQueue) cancel(id string) bool {
+	q.mutex.Lock()
+	_, ok := q.scheduled[id]
+	delete(q.scheduled, id)
+	q.mutex.Unlock()
+
+	if ok && q.store != nil {
+		q.persisted(q.store.Ack(id))
+	}
+	return ok
+}
+
+// scheduling moves due messages into the buffer.
+func (q *localQueue) scheduling() {
+	defer q.workers.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.mutex.Lock()
+		now := time.Now()
+		due := make([]*Message, 0)
+		for len(q.timeline) > 0 && !q.timeline[0].Due.After(now) {
+			msg := heap.Pop(&q.timeline).(*Message)
+			if q.scheduled[msg.Id] == msg {
+				delete(q.scheduled, msg.Id)
+				due = append(due, msg)
+			}
+		}
+		wait := time.Hour
+		if len(q.timeline) > 0 {
+			wait = q.timeline[0].Due.Sub(now)
+		}
+		q.mutex.Unlock()
+
+		for _, msg := range due {
+			// a due message was accepted already, so it always waits for room
+			if err := q.push(context.Background(), msg, true); err != nil {
+				return
+			}
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+func (h messageHeap) Len() int           { return len(h) }
+func (h messageHeap) Less(i, j int) bool { return h[i].Due.Before(h[j].Due) }
+func (h messageHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *messageHeap) Push(x Any)        { *h = append(*h, x.(*Message)) }
+func (h *messageHeap) Pop() Any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// bury keeps msg in dead letters, dropping the oldest when full.
+func (q *localQueue) bury(msg Message) {
+	q.mutex.Lock()
+	var dropped []Message
+	if q.config.Dead <= 0 {
+		dropped = []Message{msg}
+	} else {
+		q.dead = append(q.dead, msg)
+		if over := len(q.dead) - q.config.Dead; over > 0 {
+			dropped = append(dropped, q.dead[:over]...)
+			q.dead = append(q.dead[:0:0], q.dead[over:]...)
+		}
+	}
+	q.mutex.Unlock()
+
+	if q.store == nil {
+		return
+	}
+	if q.config.Dead > 0 {
+		q.persisted(q.store.Dead(msg))
+	}
+	for _, item := range dropped {
+		q.persisted(q.store.Ack(item.Id))
+	}
+}
+
+// persisted logs a failed wal write.
+func (q *localQueue) persisted(err error) {
+	if err != nil {
+		logger.Logger("queue").Error("queue wal write failed", "queue", q.name, "error", err.Error())
+	}
+}
+
+// take removes dead messages by ids, all when no ids given.
+func (q *localQueue) take(ids ...string) []Message {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	taken, kept := make([]Message, 0), make([]Message, 0, len(q.dead))
+	for _, msg := range q.dead {
+		if len(ids) == 0 || slices.Contains(ids, msg.Id) {
+			taken = append(taken, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	q.dead = kept
+	return taken
+}
+
+func (q *localQueue) stats() QueueStats {
+	q.mutex.Lock()
+	delayed, dead := len(q.scheduled), len(q.dead)
+	q.mutex.Unlock()
+
+	return QueueStats{
+		Name: q.name, Workers: q.config.Workers,
+		Capacity: cap(q.buffer), Depth: len(q.buffer),
+		Inflight: q.inflight.Load(), Delayed: delayed, Dead: dead,
+		Enqueued: q.enqueued.Load(), Processed: q.processed.Load(),
+		Failed: q.failed.Load(), Retried: q.retried.Load(), Rejected: q.rejected.Load(),
+	}
+}
+
+// Queues returns statistics of local queues.
+func Queues() []QueueStats {
+	return queues.Stats()
+}
+
+// DeadLetters returns dead messages of a local queue.
+func DeadLetters(queue string) []Message {
+	return queues.DeadLetters(queue)
+}
+
+// Replay enqueues dead messages of a local queue again, all when no ids given.
+func Replay(queue string, ids ...string) (int, error) {
+	return queues.Replay(queue, ids...)
+}
+
+// Purge drops dead messages of a local queue, all when no ids given.
+func Purge(queue string, ids ...string) int {
+	return queues.Purge(queue, ids...)
+}
+
+// EnqueueAt keeps a message in the local queue until the given time, then
+// runs it locally or sends it through the bus like Enqueue when no local
+// entry serves it. Returns the message id for CancelEnqueue.
+func EnqueueAt(meta *Meta, name string, at time.Time, values ...Map) (string, error) {
+	value := Map{}
+	if len(values) > 0 && values[0] != nil {
+		value = values[0]
+	}
+	if meta == nil {
+		meta = NewMeta()
+	}
+	span := tracer.Begin(meta, ENQUEUE, name)
+	id, err := queues.Schedule(meta, name, value, at)
+	tracer.Finish(meta, span, resultOf(err))
+	return id, err
+}
+
+// EnqueueAfter sends a message to the local queue to run after delay.
+func EnqueueAfter(meta *Meta, name string, delay time.Duration, values ...Map) (string, error) {
+	return EnqueueAt(meta, name, time.Now().Add(delay), values...)
+}
+
+// CancelEnqueue cancels a scheduled message which is not due yet.
+func CancelEnqueue(id string) bool {
+	return queues.Cancel(id)
+}
+
+// EnqueueAt sends a message to the local queue to run at the given time.
+func (m *Meta) EnqueueAt(name string, at time.Time, values ...Map) (string, error) {
+	return EnqueueAt(m, name, at, values...)
+}
+
+// EnqueueAfter sends a message to the local queue to run after delay.
+func (m *Meta) EnqueueAfter(name string, delay time.Duration, values ...Map) (string, error) {
+	return EnqueueAt(m, name, time.Now().Add(delay), values...)
+}
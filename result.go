@@ -17,6 +17,14 @@ var (
 
 	varEmpty = Result(7, "varempty", "%s不可为空")
 	varError = Result(8, "varerror", "%s无效")
+
+	Timeout = Result(9, "timeout", "请求超时")
+	// Panic carries the recovered value and stack as args.
+	Panic = Result(10, "panic", "服务异常")
+	// Unavailable is returned when the circuit breaker of a service is open.
+	Unavailable = Result(11, "unavailable", "服务暂不可用")
+	// Limited is returned when rate limit or concurrency limit is exceeded.
+	Limited = Result(12, "limited", "请求过于频繁")
 )
 
 type (
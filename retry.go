@@ -0,0 +1,153 @@
+package bamgoo
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	defaultRetryDelay    = 100 * time.Millisecond
+	defaultRetryMaxDelay = 10 * time.Second
+	defaultRetryJitter   = 0.2
+)
+
+type (
+	// retryPolicy decides how many attempts an invocation gets.
+	// Setting["retry"] accepts attempts as number, true for 3 attempts, or
+	// Map{"attempts": 3, "delay": "100ms", "max": "10s", "jitter": 0.2, "codes": []Any{"retry", 9}}.
+	retryPolicy struct {
+		Attempts int
+		Delay    time.Duration
+		MaxDelay time.Duration
+		Jitter   float64
+		Codes    []int
+	}
+)
+
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{
+		Attempts: 1,
+		Delay:    defaultRetryDelay,
+		MaxDelay: defaultRetryMaxDelay,
+		Jitter:   defaultRetryJitter,
+		Codes:    []int{Retry.Code()},
+	}
+}
+
+// parseRetryPolicy overlays value onto policy.
+func parseRetryPolicy(policy retryPolicy, value Any) retryPolicy {
+	switch vv := value.(type) {
+	case bool:
+		if vv && policy.Attempts < 2 {
+			policy.Attempts = 3
+		} else if !vv {
+			policy.Attempts = 1
+		}
+	case int:
+		policy.Attempts = vv
+	case int64:
+		policy.Attempts = int(vv)
+	case float64:
+		policy.Attempts = int(vv)
+	case Map:
+		if attempts, ok := vv["attempts"]; ok {
+			policy = parseRetryPolicy(policy, attempts)
+		}
+		if delay, ok := parseDuration(vv["delay"]); ok {
+			policy.Delay = delay
+		}
+		if delay, ok := parseDuration(vv["max"]); ok {
+			policy.MaxDelay = delay
+		}
+		switch jitter := vv["jitter"].(type) {
+		case float64:
+			policy.Jitter = jitter
+		case int64:
+			policy.Jitter = float64(jitter)
+		}
+		if codes, ok := vv["codes"]; ok {
+			policy.Codes = parseRetryCodes(codes)
+		}
+	}
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+	return policy
+}
+
+// parseRetryCodes accepts result codes or registered state names.
+func parseRetryCodes(value Any) []int {
+	codes := make([]int, 0)
+	add := func(item Any) {
+		switch vv := item.(type) {
+		case int:
+			codes = append(codes, vv)
+		case int64:
+			codes = append(codes, int(vv))
+		case float64:
+			codes = append(codes, int(vv))
+		case string:
+			if code := basic.StateCode(vv); code >= 0 {
+				codes = append(codes, code)
+			}
+		}
+	}
+	switch vv := value.(type) {
+	case []Any:
+		for _, item := range vv {
+			add(item)
+		}
+	case []int:
+		codes = append(codes, vv...)
+	case []string:
+		for _, item := range vv {
+			add(item)
+		}
+	default:
+		add(vv)
+	}
+	return codes
+}
+
+// retryPolicyOf returns the retry policy of the entry name resolves to.
+func retryPolicyOf(name string) retryPolicy {
+	policy := core.config.Retry
+	if entry, _, ok := core.resolve(name); ok {
+		if vv, ok := entry.Setting["retry"]; ok {
+			policy = parseRetryPolicy(policy, vv)
+		}
+	}
+	return policy
+}
+
+// retryable reports whether res should be attempted again.
+func (p retryPolicy) retryable(res Res) bool {
+	if res == nil || res.OK() {
+		return false
+	}
+	if vv, ok := res.(*result); ok && vv.retry {
+		return true
+	}
+	return slices.Contains(p.Codes, res.Code())
+}
+
+// backoff returns the delay before the next attempt, exponential with jitter.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
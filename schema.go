@@ -0,0 +1,358 @@
+package bamgoo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	openAPIVersion  = "3.1.0"
+)
+
+var (
+	errInvalidSchema = errors.New("Invalid json schema.")
+
+	// schemaTypes maps var type names to json schema type and format.
+	schemaTypes = map[string][2]string{
+		"int": {"integer", ""}, "int8": {"integer", ""}, "int16": {"integer", ""}, "int32": {"integer", "int32"},
+		"int64": {"integer", "int64"}, "integer": {"integer", ""}, "uint": {"integer", ""}, "uint64": {"integer", ""},
+		"float": {"number", ""}, "float32": {"number", "float"}, "float64": {"number", "double"},
+		"number": {"number", ""}, "decimal": {"number", ""},
+		"bool": {"boolean", ""}, "boolean": {"boolean", ""},
+		"map": {"object", ""}, "json": {"object", ""}, "object": {"object", ""},
+		"string": {"string", ""}, "text": {"string", ""},
+		"datetime": {"string", "date-time"}, "timestamp": {"string", "date-time"},
+		"date": {"string", "date"}, "time": {"string", "time"},
+		"email": {"string", "email"}, "url": {"string", "uri"}, "uuid": {"string", "uuid"},
+	}
+)
+
+// VarsSchema converts Vars into a json schema object.
+func (this *basicModule) VarsSchema(config Vars) Map {
+	properties := Map{}
+	required := make([]string, 0)
+
+	for name, field := range config {
+		if field.Nil() {
+			continue
+		}
+		properties[name] = this.varSchema(field)
+		if field.Required && !field.Nullable {
+			required = append(required, name)
+		}
+	}
+
+	schema := Map{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (this *basicModule) varSchema(field Var) Map {
+	typeName, isArray := field.Type, false
+	if strings.HasPrefix(typeName, "[") && strings.HasSuffix(typeName, "]") {
+		typeName, isArray = strings.TrimSuffix(strings.TrimPrefix(typeName, "["), "]"), true
+	}
+
+	schema := Map{}
+	if field.Children != nil {
+		schema = this.VarsSchema(field.Children)
+	} else {
+		jsonType, format := this.schemaType(typeName)
+		schema["type"] = jsonType
+		if format != "" {
+			schema["format"] = format
+		}
+	}
+	if isArray {
+		schema = Map{"type": "array", "items": schema}
+	}
+	if field.Nullable {
+		schema["type"] = []Any{schema["type"], "null"}
+	}
+
+	if field.Type != "" {
+		schema["x-bamgoo-type"] = field.Type
+	}
+	if field.Name != "" {
+		schema["title"] = field.Name
+	}
+	if field.Text != "" {
+		schema["description"] = field.Text
+	} else if config, ok := this.types[typeName]; ok && config.Desc != "" {
+		schema["description"] = config.Desc
+	}
+	if field.Default != nil {
+		// function defaults are evaluated per call, so they are not exported
+		if reflect.TypeOf(field.Default).Kind() != reflect.Func {
+			schema["default"] = normalizeDefault(field.Default)
+		}
+	}
+	if len(field.Options) > 0 {
+		enum := make([]string, 0, len(field.Options))
+		for key := range field.Options {
+			enum = append(enum, key)
+		}
+		sort.Strings(enum)
+		schema["enum"] = enum
+	}
+	return schema
+}
+
+// schemaType resolves json schema type by var type name or its registered alias.
+func (this *basicModule) schemaType(name string) (string, string) {
+	if vv, ok := schemaTypes[strings.ToLower(name)]; ok {
+		return vv[0], vv[1]
+	}
+	if config, ok := this.types[name]; ok {
+		if vv, ok := schemaTypes[strings.ToLower(config.Name)]; ok {
+			return vv[0], vv[1]
+		}
+		for _, alias := range config.Alias {
+			if vv, ok := schemaTypes[strings.ToLower(alias)]; ok {
+				return vv[0], vv[1]
+			}
+		}
+	}
+	return "string", ""
+}
+
+// SchemaVars converts a json schema object into Vars.
+func (this *basicModule) SchemaVars(schema Map) (Vars, error) {
+	properties, ok := schema["properties"].(Map)
+	if !ok {
+		return nil, errInvalidSchema
+	}
+
+	required := map[string]bool{}
+	if list, ok := schema["required"].([]Any); ok {
+		for _, item := range list {
+			if name, ok := item.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+	if list, ok := schema["required"].([]string); ok {
+		for _, name := range list {
+			required[name] = true
+		}
+	}
+
+	config := Vars{}
+	for name, item := range properties {
+		prop, ok := item.(Map)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errInvalidSchema, name)
+		}
+		field, err := this.schemaVar(prop)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, name)
+		}
+		field.Required = required[name]
+		config[name] = field
+	}
+	return config, nil
+}
+
+func (this *basicModule) schemaVar(schema Map) (Var, error) {
+	field := Var{}
+
+	jsonType, nullable := schemaTypeName(schema["type"])
+	field.Nullable = nullable
+
+	if title, ok := schema["title"].(string); ok {
+		field.Name = title
+	}
+	if desc, ok := schema["description"].(string); ok {
+		field.Text = desc
+	}
+	if value, ok := schema["default"]; ok {
+		field.Default = value
+	}
+	if enum, ok := schema["enum"].([]Any); ok {
+		field.Options = Map{}
+		for _, item := range enum {
+			key := fmt.Sprintf("%v", item)
+			field.Options[key] = key
+		}
+	}
+
+	itemType := ""
+	switch jsonType {
+	case "array":
+		items, _ := schema["items"].(Map)
+		if items != nil {
+			if _, ok := items["properties"]; ok {
+				children, err := this.SchemaVars(items)
+				if err != nil {
+					return field, err
+				}
+				field.Children = children
+			}
+			itemType, _ = schemaTypeName(items["type"])
+			itemType = varTypeName(itemType, items["format"])
+		}
+		field.Type = "[" + itemType + "]"
+	case "object":
+		if _, ok := schema["properties"]; ok {
+			children, err := this.SchemaVars(schema)
+			if err != nil {
+				return field, err
+			}
+			field.Children = children
+		}
+		field.Type = "map"
+	default:
+		field.Type = varTypeName(jsonType, schema["format"])
+	}
+
+	if name, ok := schema["x-bamgoo-type"].(string); ok && name != "" {
+		field.Type = name
+	}
+	return field, nil
+}
+
+// schemaTypeName extracts json type name and nullable flag from "type".
+func schemaTypeName(value Any) (string, bool) {
+	switch vv := value.(type) {
+	case string:
+		return vv, false
+	case []Any:
+		name, nullable := "", false
+		for _, item := range vv {
+			if str, ok := item.(string); ok {
+				if str == "null" {
+					nullable = true
+				} else if name == "" {
+					name = str
+				}
+			}
+		}
+		return name, nullable
+	}
+	return "", false
+}
+
+// varTypeName maps json type and format back to var type name.
+func varTypeName(jsonType string, format Any) string {
+	switch format {
+	case "date-time":
+		return "datetime"
+	case "date", "time", "email", "uuid":
+		return format.(string)
+	case "uri":
+		return "url"
+	}
+	switch jsonType {
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "object":
+		return "map"
+	}
+	return "string"
+}
+
+// EntrySchema returns the json schema document of an entry's args.
+func (e *coreModule) EntrySchema(name string) (Map, bool) {
+	e.mutex.RLock()
+	entry, ok := e.entries[name]
+	e.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	schema := basic.VarsSchema(entry.Args)
+	schema["$schema"] = jsonSchemaDraft
+	schema["$id"] = name
+	schema["title"] = name
+	if entry.Desc != "" {
+		schema["description"] = entry.Desc
+	}
+	return schema, true
+}
+
+// OpenAPI returns an OpenAPI document, each entry is a POST operation on "/{name}".
+func (e *coreModule) OpenAPI() Map {
+	bamgoo.mutex.RLock()
+	title, version := bamgoo.name, bamgoo.version
+	bamgoo.mutex.RUnlock()
+	if version == "" {
+		version = "0.0.0"
+	}
+
+	paths := Map{}
+	for name, entry := range e.Entries() {
+		operation := Map{
+			"operationId": name,
+			"requestBody": Map{
+				"content": Map{
+					"application/json": Map{"schema": basic.VarsSchema(entry.Args)},
+				},
+			},
+			"responses": Map{
+				"200": Map{
+					"description": "ok",
+					"content": Map{
+						"application/json": Map{"schema": Map{"type": "object"}},
+					},
+				},
+			},
+		}
+		if entry.Desc != "" {
+			operation["summary"] = entry.Desc
+		}
+		if entry.Library != "" {
+			operation["tags"] = []string{entry.Library}
+		}
+		paths["/"+name] = Map{"post": operation}
+	}
+
+	return Map{
+		"openapi": openAPIVersion,
+		"info":    Map{"title": title, "version": version},
+		"paths":   paths,
+	}
+}
+
+// VarsSchema converts Vars into a json schema object.
+func VarsSchema(config Vars) Map {
+	return basic.VarsSchema(config)
+}
+
+// SchemaVars converts a json schema object into Vars.
+func SchemaVars(schema Map) (Vars, error) {
+	return basic.SchemaVars(schema)
+}
+
+// EntrySchema returns the json schema document of an entry's args.
+func EntrySchema(name string) (Map, bool) {
+	return core.EntrySchema(name)
+}
+
+// Schemas returns json schema documents of all entries.
+func Schemas() map[string]Map {
+	schemas := map[string]Map{}
+	for name := range core.Entries() {
+		if schema, ok := core.EntrySchema(name); ok {
+			schemas[name] = schema
+		}
+	}
+	return schemas
+}
+
+// OpenAPI returns an OpenAPI document of all entries.
+func OpenAPI() Map {
+	return core.OpenAPI()
+}
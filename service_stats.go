@@ -1,5 +1,20 @@
 package bamgoo
 
+import (
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+// statsBuckets are upper bounds of the latency histogram in milliseconds.
+var statsBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var statistics = &serviceStatistics{
+	services: make(map[string]*serviceCounter, 0),
+}
+
 // ServiceStats contains service statistics.
 type ServiceStats struct {
 	Name         string `json:"name"`
@@ -8,4 +23,169 @@ type ServiceStats struct {
 	NumErrors    int    `json:"num_errors"`
 	TotalLatency int64  `json:"total_latency_ms"`
 	AvgLatency   int64  `json:"avg_latency_ms"`
+	P50Latency   int64  `json:"p50_latency_ms"`
+	P95Latency   int64  `json:"p95_latency_ms"`
+	P99Latency   int64  `json:"p99_latency_ms"`
+	Breaker      string `json:"breaker,omitempty"`
+}
+
+type (
+	// serviceStatistics records every invocation made through core.
+	serviceStatistics struct {
+		mutex    sync.RWMutex
+		services map[string]*serviceCounter
+	}
+	serviceCounter struct {
+		name     string
+		version  string
+		requests int
+		errors   int
+		latency  time.Duration
+		// buckets counts latencies per statsBuckets, the last one is +Inf
+		buckets []int
+	}
+)
+
+// Record adds an invocation of name and version.
+func (s *serviceStatistics) Record(name, version string, res Res, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := name + "@" + version
+	counter, ok := s.services[key]
+	if !ok {
+		counter = &serviceCounter{
+			name: name, version: version,
+			buckets: make([]int, len(statsBuckets)+1),
+		}
+		s.services[key] = counter
+	}
+
+	counter.requests++
+	if res != nil && res.Fail() {
+		counter.errors++
+	}
+	counter.latency += latency
+
+	ms := float64(latency) / float64(time.Millisecond)
+	counter.buckets[sort.SearchFloat64s(statsBuckets, ms)]++
+}
+
+// snapshot copies recorded counters sorted by name and version.
+func (s *serviceStatistics) snapshot() []serviceCounter {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	counters := make([]serviceCounter, 0, len(s.services))
+	for _, counter := range s.services {
+		item := *counter
+		item.buckets = append([]int{}, counter.buckets...)
+		counters = append(counters, item)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].name == counters[j].name {
+			return counters[i].version < counters[j].version
+		}
+		return counters[i].name < counters[j].name
+	})
+	return counters
+}
+
+// Stats returns recorded statistics sorted by name and version.
+func (s *serviceStatistics) Stats() []ServiceStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := make([]ServiceStats, 0, len(s.services))
+	for _, counter := range s.services {
+		stats = append(stats, counter.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name == stats[j].Name {
+			return stats[i].Version < stats[j].Version
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func (c *serviceCounter) stats() ServiceStats {
+	stat := ServiceStats{
+		Name: c.name, Version: c.version,
+		NumRequests: c.requests, NumErrors: c.errors,
+		TotalLatency: c.latency.Milliseconds(),
+		P50Latency:   c.percentile(0.50),
+		P95Latency:   c.percentile(0.95),
+		P99Latency:   c.percentile(0.99),
+	}
+	if c.requests > 0 {
+		stat.AvgLatency = stat.TotalLatency / int64(c.requests)
+	}
+	return stat
+}
+
+// percentile estimates latency in milliseconds by interpolating inside the bucket.
+func (c *serviceCounter) percentile(q float64) int64 {
+	if c.requests == 0 {
+		return 0
+	}
+	rank := q * float64(c.requests)
+	seen := 0
+	for i, count := range c.buckets {
+		if count == 0 || float64(seen+count) < rank {
+			seen += count
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = statsBuckets[i-1]
+		}
+		if i == len(statsBuckets) {
+			return int64(lower)
+		}
+		upper := statsBuckets[i]
+		return int64(lower + (upper-lower)*(rank-float64(seen))/float64(count))
+	}
+	return int64(statsBuckets[len(statsBuckets)-1])
+}
+
+// Stats returns statistics recorded by core merged with what the bus reports,
+// with circuit breaker states of remote services.
+func Stats() []ServiceStats {
+	stats := statistics.Stats()
+
+	index := make(map[string]int, len(stats))
+	for i, stat := range stats {
+		index[stat.Name+"@"+stat.Version] = i
+	}
+	for _, stat := range hook.Stats() {
+		i, ok := index[stat.Name+"@"+stat.Version]
+		if !ok {
+			index[stat.Name+"@"+stat.Version] = len(stats)
+			stats = append(stats, stat)
+			continue
+		}
+		merged := &stats[i]
+		merged.NumRequests += stat.NumRequests
+		merged.NumErrors += stat.NumErrors
+		merged.TotalLatency += stat.TotalLatency
+		if merged.NumRequests > 0 {
+			merged.AvgLatency = merged.TotalLatency / int64(merged.NumRequests)
+		}
+		merged.P50Latency = max(merged.P50Latency, stat.P50Latency)
+		merged.P95Latency = max(merged.P95Latency, stat.P95Latency)
+		merged.P99Latency = max(merged.P99Latency, stat.P99Latency)
+	}
+
+	states := breaker.States()
+	for i, stat := range stats {
+		if state, ok := states[stat.Name]; ok {
+			stats[i].Breaker = state
+			delete(states, stat.Name)
+		}
+	}
+	for name, state := range states {
+		stats = append(stats, ServiceStats{Name: name, Breaker: state})
+	}
+	return stats
 }
@@ -0,0 +1,263 @@
+package bamgoo
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/bamgoo/base"
+)
+
+const (
+	INVOKE  = "invoke"
+	LIBRARY = "library"
+	PUBLISH = "publish"
+	ENQUEUE = "enqueue"
+)
+
+var tracer = &traceModule{}
+
+type (
+	// Span is a finished unit of work in a trace.
+	Span struct {
+		TraceId  string    `json:"trace_id"`
+		SpanId   string    `json:"span_id"`
+		ParentId string    `json:"parent_id,omitempty"`
+		Name     string    `json:"name"`
+		Kind     string    `json:"kind"`
+		Start    time.Time `json:"start"`
+		End      time.Time `json:"end"`
+		Code     int       `json:"code"`
+		State    string    `json:"state,omitempty"`
+
+		// span and parent of meta before the span began
+		prevSpan   string
+		prevParent string
+	}
+
+	// traceModule creates spans for invocations and exports finished spans.
+	// Config example:
+	// [trace]
+	// exporter = "stdout"     # stdout json lines, or "otlp" for otlp json lines file
+	// file = "trace.jsonl"    # file of the otlp exporter
+	traceModule struct{}
+
+	// stdoutTraceHook writes spans as json lines.
+	stdoutTraceHook struct {
+		mutex  sync.Mutex
+		writer io.Writer
+	}
+
+	// otlpTraceHook appends spans to a file in OTLP/JSON format, one request per line,
+	// the same format the OpenTelemetry collector file exporter reads and writes.
+	otlpTraceHook struct {
+		mutex sync.Mutex
+		file  *os.File
+	}
+)
+
+// Duration returns how long the span took.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+func (m *traceModule) Register(string, Any) {}
+
+// Config attaches the built-in exporter selected by config.
+func (m *traceModule) Config(global Map) {
+	cfg, ok := global["trace"].(Map)
+	if !ok {
+		return
+	}
+	hook.mutex.RLock()
+	previous, _ := hook.trace.(*otlpTraceHook)
+	hook.mutex.RUnlock()
+
+	exporter, _ := cfg["exporter"].(string)
+	switch exporter {
+	case "stdout":
+		hook.AttachTrace(&stdoutTraceHook{writer: os.Stdout})
+	case "otlp":
+		file, _ := cfg["file"].(string)
+		if file == "" {
+			file = "trace.jsonl"
+		}
+		out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			panic(fmt.Errorf("open trace file failed: %w", err))
+		}
+		hook.AttachTrace(&otlpTraceHook{file: out})
+	default:
+		return
+	}
+
+	// the replaced exporter no longer gets spans, its file is done
+	if previous != nil {
+		previous.close()
+	}
+}
+
+func (m *traceModule) Setup() {}
+func (m *traceModule) Open()  {}
+func (m *traceModule) Start() {}
+func (m *traceModule) Stop()  {}
+func (m *traceModule) Close() {
+	hook.mutex.RLock()
+	exporter, ok := hook.trace.(*otlpTraceHook)
+	hook.mutex.RUnlock()
+	if ok {
+		exporter.close()
+	}
+}
+
+// Begin starts a span as child of the current span of meta, creating the trace
+// id when missing. Meta carries the new span until Finish, so nested calls and
+// bus metadata see it as parent.
+func (m *traceModule) Begin(meta *Meta, kind, name string) *Span {
+	meta.mutex.Lock()
+	defer meta.mutex.Unlock()
+
+	if meta.traceId == "" {
+		meta.traceId = newTraceId()
+	}
+	span := &Span{
+		TraceId: meta.traceId, SpanId: newSpanId(), ParentId: meta.spanId,
+		Name: name, Kind: kind, Start: time.Now(),
+		prevSpan: meta.spanId, prevParent: meta.parentId,
+	}
+	meta.spanId, meta.parentId = span.SpanId, span.ParentId
+	return span
+}
+
+// Finish ends the span with res and exports it. Meta gets its previous span back
+// unless something else took over meta in the meantime.
+func (m *traceModule) Finish(meta *Meta, span *Span, res Res) {
+	span.End = time.Now()
+	if res != nil {
+		span.Code, span.State = res.Code(), res.State()
+	}
+
+	meta.mutex.Lock()
+	if meta.spanId == span.SpanId {
+		meta.spanId, meta.parentId = span.prevSpan, span.prevParent
+	}
+	meta.mutex.Unlock()
+
+	hook.ExportSpan(*span)
+}
+
+// resume puts span back onto meta, used when an abandoned attempt may have left
+// its own child span there.
+func (m *traceModule) resume(meta *Meta, span *Span) {
+	if span == nil {
+		return
+	}
+	meta.mutex.Lock()
+	meta.spanId, meta.parentId = span.SpanId, span.ParentId
+	meta.mutex.Unlock()
+}
+
+func newTraceId() string {
+	var id [16]byte
+	for i := 0; i < len(id); i += 8 {
+		n := rand.Uint64()
+		for j := 0; j < 8; j++ {
+			id[i+j] = byte(n >> (8 * j))
+		}
+	}
+	return hex.EncodeToString(id[:])
+}
+
+func newSpanId() string {
+	n := rand.Uint64()
+	for n == 0 {
+		n = rand.Uint64()
+	}
+	return fmt.Sprintf("%016x", n)
+}
+
+func (h *stdoutTraceHook) ExportSpan(span Span) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, _ = h.writer.Write(append(line, '\n'))
+}
+
+func (h *otlpTraceHook) ExportSpan(span Span) {
+	bamgoo.mutex.RLock()
+	name, role, node, version := bamgoo.name, bamgoo.role, bamgoo.node, bamgoo.version
+	bamgoo.mutex.RUnlock()
+
+	status := Map{"code": 1}
+	if span.Code != 0 {
+		status = Map{"code": 2, "message": span.State}
+	}
+	kind := 1 // internal
+	switch span.Kind {
+	case PUBLISH, ENQUEUE:
+		kind = 4 // producer
+	}
+
+	request := Map{
+		"resourceSpans": []Map{{
+			"resource": Map{"attributes": []Map{
+				otlpAttribute("service.name", name),
+				otlpAttribute("service.namespace", role),
+				otlpAttribute("service.instance.id", node),
+				otlpAttribute("service.version", version),
+			}},
+			"scopeSpans": []Map{{
+				"scope": Map{"name": BAMGOO},
+				"spans": []Map{{
+					"traceId":           span.TraceId,
+					"spanId":            span.SpanId,
+					"parentSpanId":      span.ParentId,
+					"name":              span.Name,
+					"kind":              kind,
+					"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+					"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+					"attributes": []Map{
+						otlpAttribute("bamgoo.kind", span.Kind),
+						{"key": "bamgoo.code", "value": Map{"intValue": strconv.Itoa(span.Code)}},
+					},
+					"status": status,
+				}},
+			}},
+		}},
+	}
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.file != nil {
+		_, _ = h.file.Write(append(line, '\n'))
+	}
+}
+
+// close flushes and closes the file, spans exported later are dropped.
+func (h *otlpTraceHook) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.file == nil {
+		return
+	}
+	_ = h.file.Sync()
+	_ = h.file.Close()
+	h.file = nil
+}
+
+func otlpAttribute(key, value string) Map {
+	return Map{"key": key, "value": Map{"stringValue": value}}
+}
@@ -70,6 +70,7 @@ func (m *triggerModule) Setup() {
 			action := cfg.Action // capture for closure
 			core.RegisterMethod(methodName, Method{
 				Name: cfg.Name, Desc: cfg.Desc,
+				Nullable: cfg.Nullable, Args: cfg.Args,
 				Action: func(ctx *Context) (Map, Res) {
 					action(ctx)
 					return nil, nil
@@ -99,6 +100,7 @@ func (m *triggerModule) Toggle(name string, values ...Map) {
 		value = values[0]
 	}
 	if ms, ok := m.methods[name]; ok {
+		metrics.trigger(name)
 		for _, methodName := range ms {
 			go core.Invoke(nil, methodName, value)
 		}
@@ -111,12 +113,25 @@ func (m *triggerModule) SyncToggle(name string, values ...Map) {
 		value = values[0]
 	}
 	if ms, ok := m.methods[name]; ok {
+		metrics.trigger(name)
 		for _, methodName := range ms {
 			core.Invoke(nil, methodName, value)
 		}
 	}
 }
 
+// Triggers returns all registered triggers keyed by name.
+func (m *triggerModule) Triggers() map[string][]Trigger {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	triggers := make(map[string][]Trigger, len(m.triggers))
+	for k, v := range m.triggers {
+		triggers[k] = append([]Trigger{}, v...)
+	}
+	return triggers
+}
+
 func Toggle(name string, values ...Map) {
 	trigger.Toggle(name, values...)
 }
@@ -124,3 +139,8 @@ func Toggle(name string, values ...Map) {
 func SyncToggle(name string, values ...Map) {
 	trigger.SyncToggle(name, values...)
 }
+
+// Triggers returns all registered triggers keyed by name.
+func Triggers() map[string][]Trigger {
+	return trigger.Triggers()
+}
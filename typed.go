@@ -0,0 +1,333 @@
+package bamgoo
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	. "github.com/bamgoo/base"
+)
+
+var (
+	structVarsCache sync.Map
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// Call invokes name with req encoded into the value Map,
+// then decodes the returned Map into Resp.
+// Fields are keyed by their json tag, and a var tag declares the Var rules:
+//
+//	type UserReq struct {
+//	    Id   int64  `json:"id" var:"type=int,required"`
+//	    Name string `json:"name" var:"type=string,name=用户名"`
+//	}
+//
+// Req and Resp may also be Map to skip the struct conversion.
+func Call[Req any, Resp any](meta *Meta, name string, req Req, settings ...Map) (Resp, Res) {
+	var resp Resp
+
+	if meta == nil {
+		meta = NewMeta()
+	}
+
+	value, res := StructMap(req, meta.Timezone())
+	if res != nil && res.Fail() {
+		return resp, res
+	}
+
+	data, res := core.Invoke(meta, name, value, settings...)
+	if res != nil && res.Fail() {
+		return resp, res
+	}
+
+	if res := MapStruct(data, &resp, meta.Timezone()); res != nil && res.Fail() {
+		return resp, res
+	}
+	return resp, res
+}
+
+// StructMap encodes a struct into Map and validates it by its var tags.
+func StructMap(obj Any, zones ...*time.Location) (Map, Res) {
+	if obj == nil {
+		return Map{}, nil
+	}
+	if vv, ok := obj.(Map); ok {
+		return vv, nil
+	}
+
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return Map{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, Invalid
+	}
+
+	value := structValue(rv)
+	vars := StructVars(rv.Type())
+	if len(vars) == 0 {
+		return value, nil
+	}
+
+	mapped := Map{}
+	if res := basic.Mapping(vars, value, mapped, false, false, zones...); res != nil && res.Fail() {
+		return nil, res
+	}
+	for k, v := range mapped {
+		value[k] = v
+	}
+	return value, nil
+}
+
+// MapStruct validates data by the var tags of obj and decodes it into obj.
+// obj must be a pointer.
+func MapStruct(data Map, obj Any, zones ...*time.Location) Res {
+	if data == nil {
+		return nil
+	}
+	if vv, ok := obj.(*Map); ok {
+		*vv = data
+		return nil
+	}
+
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return Invalid
+	}
+
+	value := Map{}
+	for k, v := range data {
+		value[k] = v
+	}
+	if vars := StructVars(rv.Type().Elem()); len(vars) > 0 {
+		mapped := Map{}
+		if res := basic.Mapping(vars, data, mapped, false, false, zones...); res != nil && res.Fail() {
+			return res
+		}
+		for k, v := range mapped {
+			value[k] = v
+		}
+	}
+
+	bts, err := json.Marshal(value)
+	if err != nil {
+		return errorResult(err)
+	}
+	if err := json.Unmarshal(bts, obj); err != nil {
+		return errorResult(err)
+	}
+	return nil
+}
+
+// StructVars builds Vars from the var tags of a struct type.
+// Fields without var tag are not included, embedded structs are flattened
+// like encoding/json does. A type nested in itself gets no Children there.
+func StructVars(typ reflect.Type) Vars {
+	return structVars(typ, make(map[reflect.Type]bool, 0))
+}
+
+// structVars builds Vars of typ, building holds the types being built.
+func structVars(typ reflect.Type, building map[reflect.Type]bool) Vars {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || building[typ] {
+		return nil
+	}
+	if vars, ok := structVarsCache.Load(typ); ok {
+		return vars.(Vars)
+	}
+	building[typ] = true
+	defer delete(building, typ)
+
+	vars, embedded := Vars{}, Vars{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if inner, ok := embeddedStruct(field); ok {
+			for key, config := range structVars(inner, building) {
+				embedded[key] = config
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		key, ok := structFieldKey(field)
+		if !ok {
+			continue
+		}
+		tag, ok := field.Tag.Lookup("var")
+		if !ok || tag == "-" {
+			continue
+		}
+		config := parseVarTag(tag)
+
+		elem := field.Type
+		for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct && elem != timeType {
+			config.Children = structVars(elem, building)
+		}
+		vars[key] = config
+	}
+	// fields of the struct itself win over embedded ones
+	for key, config := range embedded {
+		if _, ok := vars[key]; !ok {
+			vars[key] = config
+		}
+	}
+
+	// a type built inside a cycle misses the Children of the cycle, only the
+	// outermost type is complete and cached
+	if len(building) == 1 {
+		structVarsCache.Store(typ, vars)
+	}
+	return vars
+}
+
+// embeddedStruct returns the struct type of an embedded field without json name,
+// whose fields are promoted into the outer struct.
+func embeddedStruct(field reflect.StructField) (reflect.Type, bool) {
+	if !field.Anonymous {
+		return nil, false
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return nil, false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ, typ.Kind() == reflect.Struct && typ != timeType
+}
+
+// parseVarTag parses `var:"type=int,required,nullable,name=xx,default=1,encode=xx,decode=xx"`.
+func parseVarTag(tag string) Var {
+	config := Var{}
+	for _, item := range strings.Split(tag, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch strings.ToLower(key) {
+		case "required":
+			config.Required = true
+		case "nullable":
+			config.Nullable = true
+		case "type":
+			config.Type = val
+		case "name":
+			config.Name = val
+		case "text":
+			config.Text = val
+		case "default":
+			config.Default = val
+		case "encode":
+			config.Encode = val
+		case "decode":
+			config.Decode = val
+		}
+	}
+	return config
+}
+
+// structFieldKey returns the Map key of a field from its json tag.
+func structFieldKey(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// structValue converts a struct into Map, nested structs into Map or []Map.
+// Embedded structs are flattened like encoding/json does.
+func structValue(rv reflect.Value) Map {
+	value, embedded := Map{}, Map{}
+	typ := rv.Type()
+	if !rv.CanAddr() {
+		addressable := reflect.New(typ).Elem()
+		addressable.Set(rv)
+		rv = addressable
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := embeddedStruct(field); ok {
+			fv := rv.Field(i)
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if !field.IsExported() {
+				// exported fields of an unexported embedded struct are promoted too
+				fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+			}
+			for k, v := range structValue(fv) {
+				embedded[k] = v
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		key, ok := structFieldKey(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		value[key] = reflectValue(fv)
+	}
+	for k, v := range embedded {
+		if _, ok := value[k]; !ok {
+			value[k] = v
+		}
+	}
+	return value
+}
+
+func reflectValue(rv reflect.Value) Any {
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return rv.Interface()
+		}
+		return structValue(rv)
+	case reflect.Slice, reflect.Array:
+		elem := rv.Type().Elem()
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct || elem == timeType {
+			return normalizeDefault(rv.Interface())
+		}
+		out := make([]Map, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i)
+			if item.Kind() == reflect.Pointer {
+				if item.IsNil() {
+					continue
+				}
+				item = item.Elem()
+			}
+			out = append(out, structValue(item))
+		}
+		return out
+	}
+	return normalizeDefault(rv.Interface())
+}
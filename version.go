@@ -0,0 +1,164 @@
+package bamgoo
+
+import (
+	"strconv"
+	"strings"
+)
+
+type (
+	// semver is a parsed semantic version, missing parts are -1 in constraints.
+	semver struct {
+		major, minor, patch int
+		pre                 string
+	}
+)
+
+// splitVersion splits "user.get@1.2.0" into name and version.
+func splitVersion(name string) (string, string) {
+	if i := strings.LastIndex(name, "@"); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// parseSemver parses "1.2.3", "v1.2.3-beta", partial versions leave -1.
+func parseSemver(text string) (semver, bool) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "v")
+	ver := semver{-1, -1, -1, ""}
+	if text == "" {
+		return ver, false
+	}
+	if i := strings.IndexAny(text, "-+"); i >= 0 {
+		if text[i] == '-' {
+			ver.pre = strings.SplitN(text[i+1:], "+", 2)[0]
+		}
+		text = text[:i]
+	}
+
+	parts := strings.Split(text, ".")
+	if len(parts) > 3 {
+		return ver, false
+	}
+	for i, part := range parts {
+		if part == "x" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return ver, false
+		}
+		switch i {
+		case 0:
+			ver.major = n
+		case 1:
+			ver.minor = n
+		case 2:
+			ver.patch = n
+		}
+	}
+	return ver, ver.major >= 0
+}
+
+func (v semver) stable() bool {
+	return v.pre == ""
+}
+
+// compare returns -1, 0, 1, prerelease sorts before its release.
+func (v semver) compare(o semver) int {
+	for _, pair := range [][2]int{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	}
+	return 1
+}
+
+// latestVersion returns the highest of versions matching constraint, an empty
+// constraint falls back to the highest prerelease when there is no stable release.
+func latestVersion(versions []string, constraint string) (string, bool) {
+	best, found := "", semver{}
+	for _, text := range versions {
+		version, _ := parseSemver(text)
+		if !matchVersion(constraint, version) {
+			continue
+		}
+		if best == "" || version.compare(found) > 0 {
+			best, found = text, version
+		}
+	}
+	if best == "" && constraint == "" {
+		for _, text := range versions {
+			version, _ := parseSemver(text)
+			if best == "" || version.compare(found) > 0 {
+				best, found = text, version
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// matchVersion reports whether version satisfies constraint.
+// Supported: "" / "*" / "latest" for latest stable, "^1.2", "~1.2", "1", "1.2", "1.2.3".
+// Prerelease versions only match an exact constraint.
+func matchVersion(constraint string, version semver) bool {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" || constraint == "latest" {
+		return version.stable()
+	}
+
+	op := constraint[0]
+	if op == '^' || op == '~' || op == '=' {
+		constraint = constraint[1:]
+	}
+	want, ok := parseSemver(constraint)
+	if !ok {
+		return false
+	}
+	if !version.stable() || want.pre != "" {
+		return want.pre == version.pre && want.major == version.major &&
+			want.minor == version.minor && want.patch == version.patch
+	}
+
+	lower := semver{want.major, max(want.minor, 0), max(want.patch, 0), ""}
+	if version.compare(lower) < 0 {
+		return false
+	}
+
+	switch {
+	case op == '^' && want.major > 0, op == '^' && want.minor < 0:
+		return version.major == want.major
+	case op == '^' && want.minor > 0, op == '^' && want.patch < 0:
+		return version.major == want.major && version.minor == want.minor
+	case op == '^':
+		return version.major == want.major && version.minor == want.minor && version.patch == want.patch
+	case op == '~' && want.minor >= 0:
+		return version.major == want.major && version.minor == want.minor
+	case op == '~':
+		return version.major == want.major
+	}
+
+	// plain or "=" version matches the given parts exactly
+	if version.major != want.major {
+		return false
+	}
+	if want.minor >= 0 && version.minor != want.minor {
+		return false
+	}
+	if want.patch >= 0 && version.patch != want.patch {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,410 @@
+package bamgoo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ALWAYS   = "always"
+	INTERVAL = "interval"
+	NEVER    = "never"
+
+	walPut  = "put"
+	walDead = "dead"
+	walAck  = "ack"
+
+	walExt          = ".wal"
+	walHeaderSize   = 8
+	walMaxRecord    = 64 << 20
+	defaultWalSize  = 64 << 20
+	defaultWalFsync = time.Second
+)
+
+var errWalCorrupt = errors.New("corrupt wal record")
+
+type (
+	// walStore keeps messages of a durable queue in an append-only log of segments.
+	// Every record is length, crc32 and json, a put or dead record replaces older
+	// records of the same message and an ack removes it. Segments without live
+	// records are deleted, mostly dead segments are compacted into the active one.
+	walStore struct {
+		mutex    sync.Mutex
+		dir      string
+		fsync    string
+		interval time.Duration
+		size     int64
+
+		file    *os.File
+		segment int
+		written int64
+		dirty   bool
+		// compacting stops compaction from running again while it moves records
+		compacting bool
+
+		live   map[string]walEntry
+		counts map[int]int
+		totals map[int]int
+
+		quit chan struct{}
+		done chan struct{}
+	}
+	walEntry struct {
+		segment int
+		dead    bool
+		message Message
+	}
+	walRecord struct {
+		Op      string   `json:"op"`
+		Id      string   `json:"id"`
+		Message *Message `json:"msg,omitempty"`
+	}
+)
+
+// openWalStore recovers the log in dir and opens a new active segment.
+func openWalStore(dir, fsync string, interval time.Duration, size int64) (*walStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = defaultWalSize
+	}
+	if interval <= 0 {
+		interval = defaultWalFsync
+	}
+	s := &walStore{
+		dir: dir, fsync: fsync, interval: interval, size: size,
+		live:   make(map[string]walEntry, 0),
+		counts: make(map[int]int, 0),
+		totals: make(map[int]int, 0),
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for i, segment := range segments {
+		if err := s.replay(segment, i == len(segments)-1); err != nil {
+			return nil, err
+		}
+	}
+	last := 0
+	if len(segments) > 0 {
+		last = segments[len(segments)-1]
+	}
+	if err := s.roll(last + 1); err != nil {
+		return nil, err
+	}
+	s.compact()
+
+	if s.fsync == INTERVAL {
+		s.quit, s.done = make(chan struct{}), make(chan struct{})
+		go s.syncing()
+	}
+	return s, nil
+}
+
+// segments lists segment numbers in order.
+func (s *walStore) segments() ([]int, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]int, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, walExt) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(name, walExt)); err == nil {
+			segments = append(segments, n)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (s *walStore) path(segment int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d%s", segment, walExt))
+}
+
+// replay applies records of a segment, a torn tail of the last segment is cut off.
+func (s *walStore) replay(segment int, last bool) error {
+	file, err := os.OpenFile(s.path(segment), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s.totals[segment] += 0
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		record, n, err := readWalRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if last {
+				// the process died while writing, drop the partial record
+				return file.Truncate(offset)
+			}
+			logger.Logger("queue").Warn("skip corrupt wal segment tail", "file", s.path(segment), "offset", offset)
+			return nil
+		}
+		offset += n
+		s.apply(segment, record)
+	}
+}
+
+// apply updates live messages and segment counters, mutex must be held.
+func (s *walStore) apply(segment int, record walRecord) {
+	s.totals[segment]++
+	if old, ok := s.live[record.Id]; ok {
+		s.counts[old.segment]--
+		delete(s.live, record.Id)
+	}
+	switch record.Op {
+	case walPut, walDead:
+		if record.Message == nil {
+			return
+		}
+		s.live[record.Id] = walEntry{segment, record.Op == walDead, *record.Message}
+		s.counts[segment]++
+	}
+}
+
+func readWalRecord(reader io.Reader) (walRecord, int64, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return walRecord{}, 0, errWalCorrupt
+		}
+		return walRecord{}, 0, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if length == 0 || length > walMaxRecord {
+		return walRecord{}, 0, errWalCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return walRecord{}, 0, errWalCorrupt
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return walRecord{}, 0, errWalCorrupt
+	}
+	record := walRecord{}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return walRecord{}, 0, errWalCorrupt
+	}
+	return record, int64(walHeaderSize + length), nil
+}
+
+// roll closes the active segment and starts segment, mutex must be held.
+func (s *walStore) roll(segment int) error {
+	if s.file != nil {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(s.path(segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file, s.segment, s.written, s.dirty = file, segment, 0, false
+	s.totals[segment] += 0
+	return nil
+}
+
+// write appends a record, mutex must be held.
+func (s *walStore) write(record walRecord) error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	s.written += int64(len(buf))
+	s.dirty = true
+	if s.fsync == ALWAYS {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+		s.dirty = false
+	}
+	s.apply(s.segment, record)
+
+	if s.written >= s.size {
+		if err := s.roll(s.segment + 1); err != nil {
+			return err
+		}
+		if !s.compacting {
+			s.compact()
+		}
+	}
+	return nil
+}
+
+// compact deletes segments without live records and moves live records out of
+// segments that are mostly dead, mutex must be held. Segments go oldest first
+// and compaction stops at the first segment kept, since acks of a newer segment
+// still cancel puts of the older ones on replay.
+func (s *walStore) compact() {
+	s.compacting = true
+	defer func() { s.compacting = false }()
+
+	segments := make([]int, 0, len(s.totals))
+	for segment := range s.totals {
+		if segment != s.segment {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Ints(segments)
+
+	for _, segment := range segments {
+		if s.counts[segment] > 0 && s.counts[segment]*2 >= s.totals[segment] {
+			return
+		}
+		moved := true
+		for id, entry := range s.live {
+			if entry.segment != segment {
+				continue
+			}
+			op := walPut
+			if entry.dead {
+				op = walDead
+			}
+			message := entry.message
+			if err := s.write(walRecord{Op: op, Id: id, Message: &message}); err != nil {
+				moved = false
+				break
+			}
+		}
+		if !moved || s.counts[segment] > 0 {
+			return
+		}
+		// moved records must be on disk before the old copy goes away
+		if s.dirty {
+			if err := s.file.Sync(); err != nil {
+				return
+			}
+			s.dirty = false
+		}
+		if err := os.Remove(s.path(segment)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		delete(s.counts, segment)
+		delete(s.totals, segment)
+	}
+}
+
+func (s *walStore) syncing() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.dirty && s.file != nil {
+				if err := s.file.Sync(); err == nil {
+					s.dirty = false
+				}
+			}
+			s.mutex.Unlock()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Put records a pending message.
+func (s *walStore) Put(msg Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.write(walRecord{Op: walPut, Id: msg.Id, Message: &msg})
+}
+
+// Dead records a dead letter.
+func (s *walStore) Dead(msg Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.write(walRecord{Op: walDead, Id: msg.Id, Message: &msg})
+}
+
+// Ack removes a message.
+func (s *walStore) Ack(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.live[id]; !ok {
+		return nil
+	}
+	return s.write(walRecord{Op: walAck, Id: id})
+}
+
+// Recovered returns pending messages and dead letters, both in enqueue order.
+func (s *walStore) Recovered() ([]Message, []Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending, dead := make([]Message, 0), make([]Message, 0)
+	for _, entry := range s.live {
+		if entry.dead {
+			dead = append(dead, entry.message)
+		} else {
+			pending = append(pending, entry.message)
+		}
+	}
+	byTime := func(list []Message) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Enqueued.Before(list[j].Enqueued) })
+	}
+	byTime(pending)
+	byTime(dead)
+	return pending, dead
+}
+
+// Close syncs and closes the active segment.
+func (s *walStore) Close() error {
+	if s.quit != nil {
+		close(s.quit)
+		<-s.done
+		s.quit = nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
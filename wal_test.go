@@ -0,0 +1,98 @@
+package bamgoo
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// An ack in a newer segment must survive compaction as long as the older
+// segment with the matching put is kept, or the message comes back on restart.
+func TestWalAckSegmentKeptWhileOlderPutRemains(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openWalStore(dir, ALWAYS, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	acked := Message{Id: "acked", Queue: "billing", Name: "billing.charge", Enqueued: now}
+	pending := Message{Id: "pending", Queue: "billing", Name: "billing.charge", Enqueued: now.Add(time.Millisecond)}
+	if err := store.Put(acked); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(pending); err != nil {
+		t.Fatal(err)
+	}
+	rollWal(t, store)
+	if err := store.Ack(acked.Id); err != nil {
+		t.Fatal(err)
+	}
+	rollWal(t, store)
+
+	// crash: the store is never closed, a new one replays the same dir
+	recovered, err := openWalStore(dir, ALWAYS, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	defer store.Close()
+
+	messages, dead := recovered.Recovered()
+	if len(dead) != 0 {
+		t.Fatalf("dead letters = %d, want 0", len(dead))
+	}
+	if len(messages) != 1 || messages[0].Id != pending.Id {
+		t.Fatalf("recovered = %v, want only %q", messageIds(messages), pending.Id)
+	}
+}
+
+// Segments without live records are removed once nothing older remains.
+func TestWalCompactRemovesAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openWalStore(dir, ALWAYS, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	msg := Message{Id: "done", Queue: "mail", Name: "mail.send", Enqueued: time.Now()}
+	if err := store.Put(msg); err != nil {
+		t.Fatal(err)
+	}
+	rollWal(t, store)
+	if err := store.Ack(msg.Id); err != nil {
+		t.Fatal(err)
+	}
+	rollWal(t, store)
+
+	segments, err := store.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("segments = %v, want only the active one", segments)
+	}
+	if _, err := os.Stat(store.path(store.segment)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rollWal starts a new segment and compacts, as a full segment does.
+func rollWal(t *testing.T, store *walStore) {
+	t.Helper()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err := store.roll(store.segment + 1); err != nil {
+		t.Fatal(err)
+	}
+	store.compact()
+}
+
+func messageIds(messages []Message) []string {
+	list := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		list = append(list, msg.Id)
+	}
+	return list
+}